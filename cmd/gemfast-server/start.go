@@ -1,16 +1,28 @@
 package cmd
 
 import (
+	"context"
+	"time"
+
 	"github.com/gemfast/server/internal/api"
+	"github.com/gemfast/server/internal/cluster"
+	"github.com/gemfast/server/internal/compactindex"
+	"github.com/gemfast/server/internal/crypto"
 	"github.com/gemfast/server/internal/cve"
 	"github.com/gemfast/server/internal/db"
 	"github.com/gemfast/server/internal/filter"
 	"github.com/gemfast/server/internal/indexer"
 	"github.com/gemfast/server/internal/license"
+	"github.com/gemfast/server/internal/models"
+	"github.com/gemfast/server/internal/storage"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
+// reconcileInterval is how often the storage reconciler pulls the legacy
+// index files back down from a remote backend onto local disk.
+const reconcileInterval = 5 * time.Minute
+
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Starts the gemfast rubygems server",
@@ -28,14 +40,31 @@ func start() {
 	err := license.ValidateLicenseKey()
 	check(err)
 	log.Info().Msg("starting services")
-	cve.InitRubyAdvisoryDB()
+	err = crypto.Init()
+	check(err)
 	err = db.Connect()
 	check(err)
 	defer db.BoltDB.Close()
-	err = indexer.InitIndexer()
+	err = models.ReconcileIndexes()
 	check(err)
-	err = indexer.Get().GenerateIndex()
+	err = cluster.Init()
+	check(err)
+	err = storage.Init()
+	check(err)
+	storage.StartReconciler(context.Background(), reconcileInterval)
+	err = indexer.InitIndexer()
 	check(err)
+	// cve.InitRubyAdvisoryDB, index generation, and the compact index
+	// rebuild are periodic maintenance tasks; in cluster mode only the
+	// elected leader runs them (IsLeader is always true on a single-node
+	// deployment, so this is a no-op change there).
+	if cluster.IsLeader() {
+		cve.InitRubyAdvisoryDB()
+		err = indexer.Get().GenerateIndex()
+		check(err)
+		compactindex.Rebuild()
+	}
+	cluster.StartLeaderWorker(context.Background())
 	err = filter.InitFilter()
 	check(err)
 	err = api.Run()
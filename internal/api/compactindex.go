@@ -0,0 +1,193 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gemfast/server/internal/compactindex"
+	"github.com/gemfast/server/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// serveCompactIndexFile streams a compact index file with Range and ETag
+// support so Bundler can do incremental fetches instead of re-downloading
+// the full file on every resolve.
+func serveCompactIndexFile(c *gin.Context, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		c.String(http.StatusNotFound, "not found")
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to open index file")
+		return
+	}
+	defer f.Close()
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().Unix(), info.Size()))
+	http.ServeContent(c.Writer, c.Request, filepath.Base(path), info.ModTime(), f)
+}
+
+func localVersionsHandler(c *gin.Context) {
+	serveCompactIndexFile(c, compactindex.VersionsPath())
+}
+
+func localNamesHandler(c *gin.Context) {
+	serveCompactIndexFile(c, compactindex.NamesPath())
+}
+
+func localInfoHandler(c *gin.Context) {
+	gemName := c.Param("gem")
+	serveCompactIndexFile(c, compactindex.InfoPath(gemName))
+}
+
+// mirrorCacheDir holds the locally cached copy of the upstream compact
+// index, refreshed with conditional GETs rather than round-tripping every
+// Bundler request through to rubygems.org.
+func mirrorCacheDir() string {
+	return filepath.Join(config.Env.Dir, "mirror_compact_index")
+}
+
+// fetchUpstreamCompactIndex pulls path (e.g. "versions", "names",
+// "info/rails") from the upstream mirror, using If-None-Match against the
+// last cached ETag so an unchanged upstream file costs a 304 instead of a
+// full re-download.
+func fetchUpstreamCompactIndex(relPath string) (string, error) {
+	cachePath := filepath.Join(mirrorCacheDir(), relPath)
+	etagPath := cachePath + ".etag"
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return "", err
+	}
+	upstream, err := url.JoinPath(config.Env.MirrorUpstream, relPath)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("GET", upstream, nil)
+	if err != nil {
+		return "", err
+	}
+	if etag, err := os.ReadFile(etagPath); err == nil {
+		req.Header.Set("If-None-Match", string(etag))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch upstream compact index %s: %w", relPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return cachePath, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream returned %d for %s", resp.StatusCode, relPath)
+	}
+	out, err := os.Create(cachePath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return "", err
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		_ = os.WriteFile(etagPath, []byte(etag), 0644)
+	}
+	return cachePath, nil
+}
+
+// mirroredVersionsHandler serves the compact index /versions file, merging
+// the locally cached upstream copy with this server's own private gems
+// instead of 302-redirecting every request to rubygems.org.
+func mirroredVersionsHandler(c *gin.Context) {
+	upstreamPath, err := fetchUpstreamCompactIndex("versions")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to refresh cached upstream versions file, serving private index only")
+	}
+	serveMergedCompactIndex(c, upstreamPath, compactindex.VersionsPath())
+}
+
+// mirroredInfoHandler serves the compact index /info/<gem> file for a
+// mirrored gem, merging the cached upstream copy with any privately
+// uploaded releases of the same gem.
+func mirroredInfoHandler(c *gin.Context) {
+	gemName := c.Param("gem")
+	upstreamPath, err := fetchUpstreamCompactIndex(filepath.Join("info", gemName))
+	if err != nil {
+		log.Warn().Err(err).Str("gem", gemName).Msg("failed to refresh cached upstream info file, serving private index only")
+	}
+	serveMergedCompactIndex(c, upstreamPath, compactindex.InfoPath(gemName))
+}
+
+func mirroredNamesHandler(c *gin.Context) {
+	upstreamPath, err := fetchUpstreamCompactIndex("names")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to refresh cached upstream names file, serving private index only")
+	}
+	serveMergedCompactIndex(c, upstreamPath, compactindex.NamesPath())
+}
+
+// splitCompactIndexHeader separates a compact index file's header (an
+// optional "created_at: …" line followed by the terminating "---" line)
+// from its body lines, so the header isn't mistaken for a body line when
+// two files' bodies are merged.
+func splitCompactIndexHeader(content []byte) (header string, lines []string) {
+	const sep = "---\n"
+	text := string(content)
+	idx := strings.Index(text, sep)
+	if idx == -1 {
+		return "", nonEmptyLines(text)
+	}
+	return text[:idx+len(sep)], nonEmptyLines(text[idx+len(sep):])
+}
+
+func nonEmptyLines(text string) []string {
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// serveMergedCompactIndex merges the private index file's body lines into
+// the cached upstream file's, so privately pushed gems show up alongside
+// mirrored ones. Each file carries its own header (versions.list's
+// "created_at: …\n---\n", names/info's bare "---\n"), so naively
+// concatenating the two files would embed a second header in the middle
+// of the body; this strips each file's header, dedups and sorts the
+// combined body lines, and re-emits a single valid header.
+func serveMergedCompactIndex(c *gin.Context, upstreamPath string, privatePath string) {
+	upstream, _ := os.ReadFile(upstreamPath)
+	private, _ := os.ReadFile(privatePath)
+	header, upstreamLines := splitCompactIndexHeader(upstream)
+	_, privateLines := splitCompactIndexHeader(private)
+	if header == "" {
+		header = "---\n"
+	}
+	seen := make(map[string]bool, len(upstreamLines)+len(privateLines))
+	merged := make([]string, 0, len(upstreamLines)+len(privateLines))
+	for _, l := range append(upstreamLines, privateLines...) {
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		merged = append(merged, l)
+	}
+	sort.Strings(merged)
+	var b strings.Builder
+	b.WriteString(header)
+	for _, l := range merged {
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	c.Header("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(b.String()))
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,21 +10,41 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/gemfast/server/internal/apierr"
+	"github.com/gemfast/server/internal/cluster"
+	"github.com/gemfast/server/internal/compactindex"
 	"github.com/gemfast/server/internal/config"
 	"github.com/gemfast/server/internal/marshal"
+	"github.com/gemfast/server/internal/middleware"
 	"github.com/gemfast/server/internal/models"
+	"github.com/gemfast/server/internal/spec"
+	"github.com/gemfast/server/internal/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 )
 
 func localGemspecRzHandler(c *gin.Context) {
 	fileName := c.Param("gemspec.rz")
+	gem := models.GemFromGemParameter(fileName)
+	if !middleware.AuthorizeGemRead(c, gem.Name) {
+		c.String(http.StatusForbidden, "acl denies read access to %s", gem.Name)
+		return
+	}
 	fp := filepath.Join(config.Env.Dir, "quick/Marshal.4.8", fileName)
 	c.FileAttachment(fp, fileName)
 }
 
 func localGemHandler(c *gin.Context) {
 	fileName := c.Param("gem")
+	gem := models.GemFromGemParameter(fileName)
+	if !middleware.AuthorizeScope(c, gem.Name, "read") {
+		c.String(http.StatusForbidden, "token scope does not permit reading %s", gem.Name)
+		return
+	}
+	if !middleware.AuthorizeGemRead(c, gem.Name) {
+		c.String(http.StatusForbidden, "acl denies read access to %s", gem.Name)
+		return
+	}
 	fp := filepath.Join(config.Env.GemDir, fileName)
 	c.FileAttachment(fp, fileName)
 }
@@ -43,7 +64,7 @@ func localDependenciesHandler(c *gin.Context) {
 	}
 	deps, err := fetchGemDependencies(c, gemQuery)
 	if err != nil && config.Env.MirrorEnabled != "false" {
-		c.String(http.StatusNotFound, fmt.Sprintf("failed to fetch dependencies for gem: %s", gemQuery))
+		apierr.Write(c, apierr.NotFound.WithInstance(c.FullPath()).WithDetail(fmt.Sprintf("failed to fetch dependencies for gem: %s", gemQuery)))
 		return
 	} else if err != nil && config.Env.MirrorEnabled != "false" {
 		path, err := url.JoinPath(config.Env.MirrorUpstream, c.FullPath())
@@ -57,7 +78,7 @@ func localDependenciesHandler(c *gin.Context) {
 	bundlerDeps, err := marshal.DumpBundlerDeps(deps)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to marshal gem dependencies")
-		c.String(http.StatusInternalServerError, "failed to marshal gem dependencies")
+		apierr.Write(c, apierr.InternalError.WithInstance(c.FullPath()).WithDetail("failed to marshal gem dependencies"))
 		return
 	}
 	c.Header("Content-Type", "application/octet-stream; charset=utf-8")
@@ -86,7 +107,7 @@ func localUploadGemHandler(c *gin.Context) {
 	tmpfile, err := ioutil.TempFile("/tmp", "*.gem")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to create tmp file")
-		c.String(http.StatusInternalServerError, "Failed to index gem")
+		apierr.Write(c, apierr.InternalError.WithInstance(c.FullPath()).WithDetail("failed to index gem"))
 		return
 	}
 	defer os.Remove(tmpfile.Name())
@@ -94,33 +115,107 @@ func localUploadGemHandler(c *gin.Context) {
 	err = os.WriteFile(tmpfile.Name(), bodyBytes, 0644)
 	if err != nil {
 		log.Error().Err(err).Str("tmpfile", tmpfile.Name()).Msg("failed to save uploaded file")
-		c.String(http.StatusInternalServerError, "failed to index gem")
+		apierr.Write(c, apierr.InternalError.WithInstance(c.FullPath()).WithDetail("failed to index gem"))
+		return
+	}
+	s := spec.FromFile(tmpfile.Name())
+	if !middleware.AuthorizeScope(c, s.Name, "push") {
+		apierr.Write(c, apierr.Forbidden.WithInstance(c.FullPath()).WithDetail(fmt.Sprintf("token scope does not permit pushing %s", s.Name)))
+		return
+	}
+	if !middleware.AuthorizeGemWrite(c, s.Name) {
+		apierr.Write(c, apierr.Forbidden.WithInstance(c.FullPath()).WithDetail(fmt.Sprintf("acl denies write access to %s", s.Name)))
+		return
+	}
+	// Reject a known-vulnerable gem before it's indexed or gossiped to
+	// peers, so a rejection never leaves a dangling index entry pointing
+	// at a file that was never actually saved.
+	if advisory := middleware.CheckUploadCVEs(s.Name, s.Version); advisory != nil {
+		log.Warn().Str("gem", s.Name).Str("cve", advisory.Cve).Msg("refusing upload of gem with a known vulnerability")
+		apierr.Write(c, apierr.InvalidGem.WithInstance(c.FullPath()).WithDetail(fmt.Sprintf("%s contains a known vulnerability: %s", s.Name, advisory.Cve)))
 		return
 	}
 	if err = saveAndReindex(tmpfile); err != nil {
 		log.Error().Err(err).Msg("failed to reindex gem")
-		c.String(http.StatusInternalServerError, "failed to index gem")
+		apierr.Write(c, apierr.InvalidGem.WithInstance(c.FullPath()).WithDetail("failed to index gem"))
 		return
 	}
+	cluster.PublishIndexInvalidation(s.Name)
+	if raw, exists := c.Get(middleware.UserKey); exists {
+		if user, ok := raw.(models.User); ok && user.Username != "" {
+			recordGemOwnership(s.Name, user.Username)
+		}
+	}
+	gemPath := filepath.Join(config.Env.GemDir, fmt.Sprintf("%s-%s.gem", s.Name, s.Version))
+	if err := storage.Put(c.Request.Context(), filepath.ToSlash(filepath.Join("gems", filepath.Base(gemPath))), bytes.NewReader(bodyBytes)); err != nil {
+		log.Error().Err(err).Str("gem", s.Name).Msg("failed to write gem to storage backend")
+	}
+	deps := make([]models.GemDependency, len(s.Dependencies))
+	for i, d := range s.Dependencies {
+		deps[i] = models.GemDependency{Name: d.Name, Requirement: d.Requirement}
+	}
+	info := compactindex.GemVersionInfo{
+		Name:                    s.Name,
+		Version:                 s.Version,
+		Dependencies:            deps,
+		RequiredRubyVersion:     s.RequiredRubyVersion,
+		RequiredRubygemsVersion: s.RequiredRubygemsVersion,
+	}
+	if err := compactindex.AppendVersion(info, bodyBytes); err != nil {
+		log.Error().Err(err).Str("gem", s.Name).Msg("failed to append to compact index versions.list")
+	}
+	if err := compactindex.GenerateInfo(s.Name); err != nil {
+		log.Error().Err(err).Str("gem", s.Name).Msg("failed to regenerate compact index info file")
+	}
 	c.String(http.StatusOK, "uploaded successfully")
 }
 
+// recordGemOwnership attributes a brand new gem name to the user who
+// first pushed it, so GetGemsByOwner/GetGemsByNamespace have something to
+// index; an already-owned gem name is left alone rather than letting a
+// later pusher reassign it.
+func recordGemOwnership(name, username string) {
+	existing, err := models.GetGemMetadata(name)
+	if err != nil {
+		log.Error().Err(err).Str("gem", name).Msg("failed to look up gem ownership")
+		return
+	}
+	if existing.Owner != "" {
+		return
+	}
+	namespace := name
+	if idx := strings.IndexByte(name, '-'); idx > 0 {
+		namespace = name[:idx]
+	}
+	if err := models.PutGemMetadata(models.GemMetadata{Name: name, Owner: username, Namespace: namespace}); err != nil {
+		log.Error().Err(err).Str("gem", name).Msg("failed to record gem ownership")
+	}
+}
+
 func localYankHandler(c *gin.Context) {
 	g := c.Query("gem")
 	v := c.Query("version")
 	p := c.Query("platform")
 	if g == "" || v == "" {
-		c.String(http.StatusBadRequest, "must provide both gem and version query parameters")
+		apierr.Write(c, apierr.InvalidGem.WithInstance(c.FullPath()).WithDetail("must provide both gem and version query parameters"))
+		return
+	}
+	if !middleware.AuthorizeScope(c, g, "push") {
+		apierr.Write(c, apierr.Forbidden.WithInstance(c.FullPath()).WithDetail(fmt.Sprintf("token scope does not permit yanking %s", g)))
+		return
+	}
+	if !middleware.AuthorizeGemWrite(c, g) {
+		apierr.Write(c, apierr.Forbidden.WithInstance(c.FullPath()).WithDetail(fmt.Sprintf("acl denies write access to %s", g)))
 		return
 	}
 	num, err := models.DeleteGem(g, v, p)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to yank gem")
-		c.String(http.StatusInternalServerError, "server failed to yank gem")
+		apierr.Write(c, apierr.InternalError.WithInstance(c.FullPath()).WithDetail("server failed to yank gem"))
 		return
 	}
 	if num == 0 {
-		c.String(http.StatusNotFound, "no gem matching %s %s %s was found", g, v, p)
+		apierr.Write(c, apierr.YankNotFound.WithInstance(c.FullPath()).WithDetail(fmt.Sprintf("no gem matching %s %s %s was found", g, v, p)))
 		return
 	}
 	c.String(http.StatusOK, "successfully yanked")
@@ -1,7 +1,7 @@
 package api
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,156 +9,247 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/cluster"
 	"github.com/gemfast/server/internal/filter"
 	"github.com/gemfast/server/internal/indexer"
+	"github.com/gemfast/server/internal/storage"
+	"github.com/gemfast/server/internal/upstream"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
 )
 
-func mirroredGemspecRzHandler(c *gin.Context) {
-	fileName := c.Param("gemspec.rz")
-	gemAllowed := filter.IsAllowed(fileName)
-	if !gemAllowed {
-		c.String(http.StatusForbidden, fmt.Sprintf("Refusing to download gemspec %s due to filter", fileName))
-		return
+// fetchGroup coalesces concurrent cache misses for the same key (e.g. two
+// `bundle install` runs racing on the same uncached gem) into a single
+// upstream fetch, so the second caller waits on the first's result
+// instead of triggering a duplicate download.
+var fetchGroup singleflight.Group
+
+// fetchFromUpstreams tries each candidate upstream in priority order,
+// storing the first successful response under key in the configured
+// storage backend. An upstream that fails to connect or returns a 5xx is
+// marked unhealthy for a cooldown window and the next one is tried
+// instead of failing the request outright.
+func fetchFromUpstreams(ctx context.Context, relPath string, key string) (string, error) {
+	candidates := upstream.Candidates()
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no healthy upstream mirrors are configured")
 	}
-	fp := filepath.Join(config.Env.Dir, "quick/Marshal.4.8", fileName)
-	if _, err := os.Stat(fp); errors.Is(err, os.ErrNotExist) {
-		out, err := os.Create(fp)
-		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to create gem file")
-			return
+	fileName := filepath.Base(relPath)
+	var lastErr error
+	for _, m := range candidates {
+		if !upstream.Allowed(m, fileName) {
+			lastErr = fmt.Errorf("upstream %s denies %s via its filter", m.Upstream, fileName)
+			continue
 		}
-		defer out.Close()
-		path, err := url.JoinPath(config.Env.MirrorUpstream, "quick/Marshal.4.8", fileName)
+		path, err := url.JoinPath(m.Upstream, relPath)
 		if err != nil {
-			log.Error().Str("file", fileName).Msg("failed to fetch quick marshal")
-			panic(err)
+			lastErr = err
+			continue
 		}
 		resp, err := http.Get(path)
 		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to connect to upstream")
-			return
+			upstream.MarkUnhealthy(m.Upstream)
+			lastErr = err
+			continue
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			log.Info().Str("upstream", path).Msg("upstream returned a non 200 status code")
-			c.String(resp.StatusCode, "Failure returned from upstream")
-			out.Close()
-			os.RemoveAll(fp)
-			return
+		if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			upstream.MarkUnhealthy(m.Upstream)
+			lastErr = fmt.Errorf("upstream %s returned %d", m.Upstream, resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("upstream %s returned %d", m.Upstream, resp.StatusCode)
 		}
-		_, err = io.Copy(out, resp.Body)
+		putErr := storage.Put(ctx, key, resp.Body)
+		resp.Body.Close()
+		if putErr != nil {
+			return "", putErr
+		}
+		return m.Upstream, nil
+	}
+	return "", lastErr
+}
+
+func mirroredGemspecRzHandler(c *gin.Context) {
+	fileName := c.Param("gemspec.rz")
+	if !filter.IsAllowed(fileName) {
+		c.String(http.StatusForbidden, fmt.Sprintf("Refusing to download gemspec %s due to filter", fileName))
+		return
+	}
+	key := filepath.ToSlash(filepath.Join("quick/Marshal.4.8", fileName))
+	if _, err := storage.Stat(c.Request.Context(), key); err != nil {
+		_, err, _ := fetchGroup.Do(key, func() (interface{}, error) {
+			return fetchFromUpstreams(c.Request.Context(), key, key)
+		})
 		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to write gem file")
+			log.Error().Err(err).Str("file", fileName).Msg("failed to fetch quick marshal from any upstream")
+			c.String(http.StatusBadGateway, "Failed to fetch gemspec from any configured upstream")
 			return
 		}
 	} else {
 		log.Info().Msg("serving existing gemspec.rz")
 	}
-	c.FileAttachment(fp, fileName)
+	serveStoredObject(c, key, fileName)
 }
 
 func mirroredGemHandler(c *gin.Context) {
 	fileName := c.Param("gem")
-	gemAllowed := filter.IsAllowed(fileName)
-	if !gemAllowed {
+	if !filter.IsAllowed(fileName) {
 		c.String(http.StatusForbidden, fmt.Sprintf("Refusing to download gemspec %s due to filter", fileName))
 		return
 	}
-	fp := filepath.Join(config.Env.GemDir, fileName)
-	info, err := os.Stat(fp)
-	if (err != nil && errors.Is(err, os.ErrNotExist)) || info.Size() == 0 {
-		out, err := os.Create(fp)
+	key := filepath.ToSlash(filepath.Join("gems", fileName))
+	info, err := storage.Stat(c.Request.Context(), key)
+	if err != nil || info.Size == 0 {
+		v, err, _ := fetchGroup.Do(key, func() (interface{}, error) {
+			return fetchFromUpstreams(c.Request.Context(), filepath.Join("gems", fileName), key)
+		})
 		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to create gem file")
-		}
-		defer out.Close()
-		path, err := url.JoinPath(config.Env.MirrorUpstream, "gems", fileName)
-		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to fetch gem file from upstream")
+			log.Error().Err(err).Str("file", fileName).Msg("failed to fetch gem from any upstream")
+			c.String(http.StatusBadGateway, "Failed to fetch gem from any configured upstream")
 			return
 		}
-		resp, err := http.Get(path)
+		winner := v.(string)
+		gem := parseGemNameFromFileName(fileName)
+		upstream.RecordWinner(gem, winner)
+		fp, err := stageGemForIndexing(c.Request.Context(), key, fileName)
 		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to connect to upstream")
-			return
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			log.Info().Str("upstream", path).Msg("upstream returned a non 200 status code")
-			c.String(resp.StatusCode, "Failure returned from upstream")
-			return
-		}
-		_, err = io.Copy(out, resp.Body)
-		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to write gem file")
+			log.Error().Err(err).Str("file", fileName).Msg("failed to stage gem for indexing")
+			defer storage.Delete(c.Request.Context(), key)
+			c.String(http.StatusInternalServerError, "Failed to index gem")
 			return
 		}
-		out.Close()
 		err = indexer.Get().AddGemToIndex(fp)
+		os.Remove(fp)
 		if err != nil {
-			defer os.Remove(fp)
+			defer storage.Delete(c.Request.Context(), key)
 			c.String(http.StatusInternalServerError, "Failed to index gem")
 			return
 		}
+		cluster.PublishIndexInvalidation(gem)
 	} else {
 		log.Info().Msg("serving existing gem")
 	}
-	c.FileAttachment(fp, fileName)
+	serveStoredObject(c, key, fileName)
 }
 
-func mirroredIndexHandler(c *gin.Context) {
-	path, err := url.JoinPath(config.Env.MirrorUpstream, c.FullPath())
+// serveStoredObject redirects to a presigned URL when the configured
+// storage backend supports it and storage.redirect_downloads is set,
+// otherwise streams the object through gemfast itself, same as the old
+// c.FileAttachment behavior.
+func serveStoredObject(c *gin.Context, key, fileName string) {
+	if url, ok, err := storage.RedirectURL(c.Request.Context(), key); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("failed to presign storage download url")
+	} else if ok {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+	r, err := storage.Get(c.Request.Context(), key)
 	if err != nil {
-		panic(err)
+		c.String(http.StatusInternalServerError, "Failed to read stored object")
+		return
 	}
-	c.Redirect(http.StatusFound, path)
+	defer r.Close()
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, r)
 }
 
-func mirroredInfoHandler(c *gin.Context) {
-	path, err := url.JoinPath(config.Env.MirrorUpstream, c.FullPath())
+// stageGemForIndexing copies the gem stored under key into a local temp
+// file so indexer.Get().AddGemToIndex, which only knows how to index a
+// local path, can index it regardless of which storage.Backend actually
+// holds the blob. For a remote backend (s3/gcs/azure) the gem was never
+// written to config.Env.GemDir, so indexing straight from that path
+// always failed. The caller is responsible for removing the returned
+// path once indexing is done.
+func stageGemForIndexing(ctx context.Context, key, fileName string) (string, error) {
+	r, err := storage.Get(ctx, key)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("failed to read gem from storage backend: %w", err)
 	}
-	c.Redirect(http.StatusFound, path)
-}
-
-func mirroredVersionsHandler(c *gin.Context) {
-	path, err := url.JoinPath(config.Env.MirrorUpstream, c.FullPath())
+	defer r.Close()
+	f, err := os.CreateTemp("", "*-"+fileName)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("failed to create temp file for indexing: %w", err)
 	}
-	c.Redirect(http.StatusFound, path)
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to stage gem for indexing: %w", err)
+	}
+	return f.Name(), nil
 }
 
-func mirroredDependenciesHandler(c *gin.Context) {
-	gemQuery := c.Query("gems")
-	if gemQuery == "" {
-		c.Status(http.StatusOK)
-		return
+// parseGemNameFromFileName strips the trailing -<version>.gem suffix so
+// the winning upstream can be recorded keyed by gem name.
+func parseGemNameFromFileName(fileName string) string {
+	name := fileName
+	if idx := lastDash(name); idx > 0 {
+		name = name[:idx]
 	}
-	path, err := url.JoinPath(config.Env.MirrorUpstream, c.FullPath())
-	path += "?gems="
-	path += gemQuery
-	if err != nil {
-		panic(err)
+	return name
+}
+
+func lastDash(s string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == '-' {
+			return i
+		}
 	}
-	c.Redirect(http.StatusFound, path)
+	return -1
+}
+
+// mirroredIndexHandler and the legacy index cache it serves from live in
+// revalidate.go, alongside the background revalidation goroutine that
+// keeps that cache fresh.
+
+// mirroredInfoHandler and mirroredVersionsHandler implement the compact
+// index protocol and live in compactindex.go; unlike the legacy
+// Marshal.4.8 index handled above, Bundler prefers compact index and
+// expects it to be servable directly rather than 302-redirected upstream.
+
+func mirroredDependenciesHandler(c *gin.Context) {
+	proxyDependencies(c)
 }
 
 func mirroredDependenciesJSONHandler(c *gin.Context) {
+	proxyDependencies(c)
+}
+
+// proxyDependencies streams the `/api/v1/dependencies(.json)` response
+// for gemQuery straight through from the highest-priority healthy
+// upstream rather than 302-redirecting, since bundler's resolver treats
+// this endpoint as one more gemfast response to parse, not a download it
+// can follow a redirect for itself.
+func proxyDependencies(c *gin.Context) {
 	gemQuery := c.Query("gems")
 	if gemQuery == "" {
 		c.Status(http.StatusOK)
 		return
 	}
-	path, err := url.JoinPath(config.Env.MirrorUpstream, c.FullPath())
-	path += "?gems="
-	path += gemQuery
+	candidates := upstream.Candidates()
+	if len(candidates) == 0 {
+		c.String(http.StatusBadGateway, "no healthy upstream mirrors are configured")
+		return
+	}
+	m := candidates[0]
+	path, err := url.JoinPath(m.Upstream, c.FullPath())
 	if err != nil {
 		panic(err)
 	}
-	c.Redirect(http.StatusFound, path)
+	resp, err := http.Get(path + "?gems=" + gemQuery)
+	if err != nil {
+		upstream.MarkUnhealthy(m.Upstream)
+		c.String(http.StatusBadGateway, "Failed to fetch dependencies from upstream")
+		return
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.Status(resp.StatusCode)
+	io.Copy(c.Writer, resp.Body)
 }
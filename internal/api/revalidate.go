@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/upstream"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// mirrorRevalidateInterval is how often StartMirrorRevalidator re-checks
+// the upstream's legacy index files for changes.
+const mirrorRevalidateInterval = 5 * time.Minute
+
+// legacyIndexFiles are the Marshal.4.8 index files bundler may still
+// request directly. Unlike gems and gemspecs, which are immutable once
+// published and so only need a one-time fetch on cache miss (see
+// fetchFromUpstreams), these change every time any gem is published
+// upstream, so they're kept fresh by a background revalidation goroutine
+// instead.
+var legacyIndexFiles = []string{"specs.4.8.gz", "latest_specs.4.8.gz", "prerelease_specs.4.8.gz"}
+
+func legacyIndexCacheDir() string {
+	return filepath.Join(config.Env.Dir, "mirror_index")
+}
+
+func legacyIndexLastModifiedPath(fileName string) string {
+	return filepath.Join(legacyIndexCacheDir(), fileName+".last-modified")
+}
+
+// fetchLegacyIndexFile pulls fileName from upstreamURL with a conditional
+// GET, using the Last-Modified value saved from the previous successful
+// fetch as If-Modified-Since. A 304 leaves the existing cached copy in
+// place untouched.
+func fetchLegacyIndexFile(upstreamURL, fileName string) error {
+	if err := os.MkdirAll(legacyIndexCacheDir(), 0755); err != nil {
+		return err
+	}
+	target, err := url.JoinPath(upstreamURL, fileName)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	lmPath := legacyIndexLastModifiedPath(fileName)
+	if lm, err := os.ReadFile(lmPath); err == nil {
+		req.Header.Set("If-Modified-Since", string(lm))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		upstream.MarkUnhealthy(upstreamURL)
+		return fmt.Errorf("failed to fetch %s from upstream: %w", fileName, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upstream %s returned %d for %s", upstreamURL, resp.StatusCode, fileName)
+	}
+	cachePath := filepath.Join(legacyIndexCacheDir(), fileName)
+	out, err := os.Create(cachePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return err
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		_ = os.WriteFile(lmPath, []byte(lm), 0644)
+	}
+	return nil
+}
+
+// mirroredIndexHandler serves a locally cached copy of a legacy
+// Marshal.4.8 index file, fetching it from the highest-priority healthy
+// upstream on first request. StartMirrorRevalidator keeps the cache
+// fresh afterwards, so only the very first request for a given file
+// blocks on the upstream.
+func mirroredIndexHandler(c *gin.Context) {
+	s := strings.Split(c.FullPath(), "/")
+	fileName := s[len(s)-1]
+	cachePath := filepath.Join(legacyIndexCacheDir(), fileName)
+	if _, err := os.Stat(cachePath); err != nil {
+		candidates := upstream.Candidates()
+		if len(candidates) == 0 {
+			c.String(http.StatusBadGateway, "no healthy upstream mirrors are configured")
+			return
+		}
+		if err := fetchLegacyIndexFile(candidates[0].Upstream, fileName); err != nil {
+			log.Error().Err(err).Str("file", fileName).Msg("failed to fetch legacy index file from any upstream")
+			c.String(http.StatusBadGateway, "Failed to fetch index file from any configured upstream")
+			return
+		}
+	}
+	c.FileAttachment(cachePath, fileName)
+}
+
+// StartMirrorRevalidator periodically issues a conditional GET for each
+// of legacyIndexFiles against the highest-priority healthy upstream, so
+// the cache mirroredIndexHandler serves from stays close to current
+// without every request paying the upstream round-trip. Call it once
+// from Run when mirroring is enabled.
+func StartMirrorRevalidator(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(mirrorRevalidateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				revalidateLegacyIndex()
+			}
+		}
+	}()
+}
+
+func revalidateLegacyIndex() {
+	candidates := upstream.Candidates()
+	if len(candidates) == 0 {
+		return
+	}
+	m := candidates[0]
+	for _, fileName := range legacyIndexFiles {
+		if err := fetchLegacyIndexFile(m.Upstream, fileName); err != nil {
+			log.Warn().Err(err).Str("file", fileName).Msg("mirror revalidation failed")
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package api
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"html/template"
 	"strings"
 
+	"github.com/gemfast/server/internal/cluster"
 	"github.com/gemfast/server/internal/config"
 	"github.com/gemfast/server/internal/license"
 	"github.com/gemfast/server/internal/middleware"
@@ -34,12 +36,17 @@ func Run(l *license.License) error {
 	log.Info().Str("detail", port).Msg("gemfast server listening on port")
 	if config.Cfg.Mirrors[0].Enabled {
 		log.Info().Str("detail", config.Cfg.Mirrors[0].Upstream).Msg("mirroring upstream gem server")
+		StartMirrorRevalidator(context.Background())
 	}
 	return router.Run(port)
 }
 
 func initRouter() (r *gin.Engine) {
 	gin.SetMode(gin.ReleaseMode)
+	initRateLimiters()
+	if err := middleware.InitAuthChain(); err != nil {
+		log.Error().Err(err).Msg("failed to initialize auth provider chain, /api/v1/login will reject every request")
+	}
 	r = gin.Default()
 	tmpl := template.Must(template.New("").ParseFS(efs, "templates/github/*.tmpl"))
 	r.SetHTMLTemplate(tmpl)
@@ -54,6 +61,8 @@ func initRouter() (r *gin.Engine) {
 		configureLocalAuth(r)
 	case "none":
 		configureNoneAuth(r)
+	case "oidc":
+		configureOIDCAuth(r)
 	}
 	return r
 }
@@ -70,6 +79,22 @@ func configureGitHubAuth(r *gin.Engine) {
 	configurePrivate(r)
 }
 
+func configureOIDCAuth(r *gin.Engine) {
+	oidcMiddleware, err := middleware.NewOIDCMiddleware()
+	if err != nil {
+		panic(err)
+	}
+	adminOIDCAuth := r.Group(adminAPIPath)
+	adminOIDCAuth.GET("/login", oidcMiddleware.OIDCLoginHandler)
+	slash := r.Group("/")
+	slash.GET("/oidc/callback", oidcMiddleware.OIDCCallbackHandler)
+	adminOIDCAuth.Use(oidcMiddleware.OIDCMiddlewareFunc())
+	{
+		configureAdmin(adminOIDCAuth)
+	}
+	configurePrivate(r)
+}
+
 func configureLocalAuth(r *gin.Engine) {
 	err := models.CreateAdminUserIfNotExists()
 	if err != nil {
@@ -86,6 +111,8 @@ func configureLocalAuth(r *gin.Engine) {
 	adminLocalAuth := r.Group(adminAPIPath)
 	adminLocalAuth.POST("/login", jwtMiddleware.LoginHandler)
 	adminLocalAuth.GET("/refresh-token", jwtMiddleware.RefreshHandler)
+	adminLocalAuth.POST("/refresh", middleware.RefreshHandler(jwtMiddleware))
+	adminLocalAuth.POST("/logout", middleware.LogoutHandler)
 	adminLocalAuth.Use(jwtMiddleware.MiddlewareFunc())
 	{
 		configureAdmin(adminLocalAuth)
@@ -110,23 +137,55 @@ func configureMirror(mirror *gin.RouterGroup) {
 	mirror.GET("/specs.4.8.gz", mirroredIndexHandler)
 	mirror.GET("/latest_specs.4.8.gz", mirroredIndexHandler)
 	mirror.GET("/prerelease_specs.4.8.gz", mirroredIndexHandler)
-	mirror.GET("/quick/Marshal.4.8/:gemspec.rz", mirroredGemspecRzHandler)
-	mirror.GET("/gems/:gem", mirroredGemHandler)
+	mirror.GET("/quick/Marshal.4.8/:gemspec.rz", middleware.NewCVEDownloadMiddleware(), mirroredGemspecRzHandler)
+	mirror.GET("/gems/:gem", middleware.NewCVEDownloadMiddleware(), mirroredGemHandler)
 	mirror.GET("/api/v1/dependencies", mirroredDependenciesHandler)
 	mirror.GET("/api/v1/dependencies.json", mirroredDependenciesJSONHandler)
 	mirror.GET("/info/*gem", mirroredInfoHandler)
 	mirror.GET("/versions", mirroredVersionsHandler)
+	mirror.GET("/names", mirroredNamesHandler)
+}
+
+// These are built lazily from config.Cfg.RateLimit rather than as package
+// vars, since config.Cfg isn't populated until after the config file is
+// loaded, well after package init runs.
+var (
+	readRateLimiter  *middleware.RateLimiter
+	writeRateLimiter *middleware.RateLimiter
+	adminRateLimiter *middleware.RateLimiter
+)
+
+func initRateLimiters() {
+	readRateLimiter = middleware.NewRateLimiter(middleware.RateLimitConfig{RequestsPerSecond: config.Cfg.RateLimit.ReadRPS, Burst: config.Cfg.RateLimit.ReadBurst})
+	writeRateLimiter = middleware.NewRateLimiter(middleware.RateLimitConfig{RequestsPerSecond: config.Cfg.RateLimit.WriteRPS, Burst: config.Cfg.RateLimit.WriteBurst})
+	adminRateLimiter = middleware.NewRateLimiter(middleware.RateLimitConfig{RequestsPerSecond: config.Cfg.RateLimit.AdminRPS, Burst: config.Cfg.RateLimit.AdminBurst})
 }
 
 // /private
 func configurePrivate(r *gin.Engine) {
+	// gem signin exchanges Basic username/password credentials for the
+	// long-lived api key, so it must live outside the api-key-gated group.
+	r.GET(config.Cfg.PrivateGemURL+"/api/v1/api_key", middleware.GemSigninHandler)
+	// Registration and login are themselves how a caller obtains a
+	// credential, so they must also live outside the api-key-gated group.
+	r.POST(config.Cfg.PrivateGemURL+"/api/v1/register", middleware.RegisterHandler)
+	r.POST(config.Cfg.PrivateGemURL+"/api/v1/login", middleware.LoginHandler)
 	privateTokenAuth := r.Group(config.Cfg.PrivateGemURL)
-	privateTokenAuth.Use(middleware.NewTokenMiddleware())
+	// Accepts either `user:token`/`x:token` Basic Auth (what bundler and
+	// `gem push` send natively) or falls through to bearer token auth.
+	privateTokenAuth.Use(middleware.NewBasicAuthMiddleware())
 	{
 		if !config.Cfg.Auth.AllowAnonymousRead {
 			configurePrivateRead(privateTokenAuth)
 		}
 		configurePrivateWrite(privateTokenAuth)
+		// Self-service token lifecycle for already-authenticated callers
+		// (e.g. a CI system minting itself a short-lived, narrowly scoped
+		// push token) — distinct from the admin-only POST /admin/api/v1/token.
+		privateTokenAuth.POST("/api/v1/token", middleware.IssueTokenHandler)
+		privateTokenAuth.POST("/api/v1/token/refresh", middleware.RefreshTokenHandler)
+		privateTokenAuth.POST("/api/v1/token/revoke", middleware.RevokeTokenHandler)
+		privateTokenAuth.PUT("/api/v1/user/password", middleware.ChangePasswordHandler)
 	}
 	if config.Cfg.Mirrors[0].Enabled {
 		mirror := r.Group("/")
@@ -141,11 +200,12 @@ func configurePrivate(r *gin.Engine) {
 
 // /private
 func configurePrivateRead(private *gin.RouterGroup) {
+	private.Use(readRateLimiter.Middleware())
 	private.GET("/specs.4.8.gz", localIndexHandler)
 	private.GET("/latest_specs.4.8.gz", localIndexHandler)
 	private.GET("/prerelease_specs.4.8.gz", localIndexHandler)
-	private.GET("/quick/Marshal.4.8/:gemspec.rz", localGemspecRzHandler)
-	private.GET("/gems/:gem", localGemHandler)
+	private.GET("/quick/Marshal.4.8/:gemspec.rz", middleware.NewCVEDownloadMiddleware(), middleware.NewDownloadQuotaMiddleware(), localGemspecRzHandler)
+	private.GET("/gems/:gem", middleware.NewCVEDownloadMiddleware(), middleware.NewDownloadQuotaMiddleware(), localGemHandler)
 	private.GET("/api/v1/dependencies", localDependenciesHandler)
 	private.GET("/api/v1/dependencies.json", localDependenciesJSONHandler)
 	private.GET("/versions", localVersionsHandler)
@@ -155,6 +215,7 @@ func configurePrivateRead(private *gin.RouterGroup) {
 
 // /private
 func configurePrivateWrite(private *gin.RouterGroup) {
+	private.Use(writeRateLimiter.Middleware())
 	private.POST("/api/v1/gems", localUploadGemHandler)
 	private.DELETE("/api/v1/gems/yank", localYankHandler)
 	private.POST("/upload", geminaboxUploadGem)
@@ -162,12 +223,21 @@ func configurePrivateWrite(private *gin.RouterGroup) {
 
 // /admin
 func configureAdmin(admin *gin.RouterGroup) {
+	admin.Use(adminRateLimiter.Middleware())
 	admin.GET("/auth", authMode)
 	admin.POST("/token", middleware.CreateTokenHandler)
 	admin.GET("/gems", listGems)
 	admin.GET("/gems/:gem", getGem)
+	admin.GET("/gems/:gem/cves", middleware.CVEsForGemHandler)
 	admin.GET("/users", listUsers)
 	admin.GET("/users/:username", getUser)
 	admin.DELETE("/users/:username", deleteUser)
 	admin.PUT("/users/:username/role/:role", setUserRole)
+	admin.DELETE("/users/:username/tokens", middleware.RevokeUserTokensHandler)
+	admin.GET("/users/:username/quota", middleware.QuotaInspectHandler)
+	admin.PUT("/users/:username/quota/reset", middleware.QuotaResetHandler)
+	admin.GET("/cluster/peers", cluster.PeersHandler)
+	admin.GET("/acl/:user", middleware.ListACLHandler)
+	admin.PUT("/acl/:user", middleware.PutACLHandler)
+	admin.DELETE("/acl/:user", middleware.DeleteACLHandler)
 }
@@ -0,0 +1,46 @@
+package apierr
+
+import "net/http"
+
+// catalog of stable, pre-defined problems referenced by handlers across
+// the API. Each carries a durable `type` URI so client SDKs can switch on
+// the error kind rather than parsing Title/Detail prose.
+const typeBase = "https://gemfast.dev/problems/"
+
+var (
+	NotFound = &Problem{
+		Type:   typeBase + "not-found",
+		Title:  "Resource not found",
+		Status: http.StatusNotFound,
+	}
+	InvalidGem = &Problem{
+		Type:   typeBase + "invalid-gem",
+		Title:  "Uploaded file is not a valid gem",
+		Status: http.StatusBadRequest,
+	}
+	YankNotFound = &Problem{
+		Type:   typeBase + "yank-not-found",
+		Title:  "No gem matched the requested yank",
+		Status: http.StatusNotFound,
+	}
+	UpstreamMirrorFailed = &Problem{
+		Type:   typeBase + "upstream-mirror-failed",
+		Title:  "Failed to fetch the gem from the upstream mirror",
+		Status: http.StatusBadGateway,
+	}
+	Unauthorized = &Problem{
+		Type:   typeBase + "unauthorized",
+		Title:  "Authentication is required to access this resource",
+		Status: http.StatusUnauthorized,
+	}
+	Forbidden = &Problem{
+		Type:   typeBase + "forbidden",
+		Title:  "The authenticated user does not have permission to perform this action",
+		Status: http.StatusForbidden,
+	}
+	InternalError = &Problem{
+		Type:   typeBase + "internal-error",
+		Title:  "An internal error occurred",
+		Status: http.StatusInternalServerError,
+	}
+)
@@ -0,0 +1,71 @@
+// Package apierr provides a consistent RFC 7807 "Problem Details for HTTP
+// APIs" error shape for gemfast's handlers, replacing the ad-hoc mix of
+// plain strings and gin.H{"code","message"} bodies they used to return.
+package apierr
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is a RFC 7807 problem details object. Type is a stable URI
+// identifying the error kind so SDKs can switch on it instead of parsing
+// prose; Extensions carries any additional fields a handler wants to
+// surface (e.g. a CVE id).
+type Problem struct {
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON flattens Extensions alongside the standard fields so callers
+// see e.g. {"type":...,"cve_id":"CVE-2023-..."} rather than a nested object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{
+		"type":   p.Type,
+		"title":  p.Title,
+		"status": p.Status,
+	}
+	if p.Detail != "" {
+		out["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		out["instance"] = p.Instance
+	}
+	for k, v := range p.Extensions {
+		out[k] = v
+	}
+	return json.Marshal(out)
+}
+
+func (p *Problem) Error() string {
+	return p.Title + ": " + p.Detail
+}
+
+// WithInstance returns a copy of the problem scoped to a specific request
+// path, leaving the shared catalog entry untouched.
+func (p *Problem) WithInstance(instance string) *Problem {
+	cp := *p
+	cp.Instance = instance
+	return &cp
+}
+
+// WithDetail returns a copy of the problem with a request-specific detail
+// message, leaving the shared catalog entry untouched.
+func (p *Problem) WithDetail(detail string) *Problem {
+	cp := *p
+	cp.Detail = detail
+	return &cp
+}
+
+// Write renders a Problem as application/problem+json with its status code.
+func Write(c *gin.Context, problem *Problem) {
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// LDAPProvider authenticates by binding to an LDAP directory as the user
+// (after first resolving their DN with a service-account bind + search),
+// then maps the groups that search returns to gemfast ACL permissions via
+// config.Cfg.Auth.LDAP.GroupACLMap, e.g. {"cn=gemfast-admins,ou=groups,dc=example,dc=com": "read-write"}.
+type LDAPProvider struct{}
+
+func NewLDAPProvider() *LDAPProvider {
+	return &LDAPProvider{}
+}
+
+func (p *LDAPProvider) Name() string {
+	return "ldap"
+}
+
+func (p *LDAPProvider) Authenticate(ctx context.Context, creds Credentials) (models.User, error) {
+	cfg := config.Cfg.Auth.LDAP
+	conn, err := ldap.DialURL(cfg.URL)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to connect to ldap server: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+		return models.User{}, fmt.Errorf("failed to bind ldap service account: %w", err)
+	}
+
+	searchReq := ldap.NewSearchRequest(
+		cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(cfg.UserFilter, ldap.EscapeFilter(creds.Username)),
+		[]string{"dn", "memberOf"},
+		nil,
+	)
+	result, err := conn.Search(searchReq)
+	if err != nil {
+		return models.User{}, fmt.Errorf("ldap search failed: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return models.User{}, fmt.Errorf("ldap user %s not found or ambiguous", creds.Username)
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, creds.Password); err != nil {
+		return models.User{}, fmt.Errorf("invalid ldap credentials: %w", err)
+	}
+
+	user, err := EnsureShadowUser(creds.Username, p.Name())
+	if err != nil {
+		return models.User{}, err
+	}
+	p.syncGroupACLs(creds.Username, entry.GetAttributeValues("memberOf"))
+	return user, nil
+}
+
+// syncGroupACLs applies the permission configured for each LDAP group the
+// user is a member of, so access follows directory group membership
+// rather than needing a gemfast admin to mirror it by hand. Unmapped
+// groups are ignored; a user in no mapped group keeps whatever ACL
+// entries (or lack of them) they already had.
+func (p *LDAPProvider) syncGroupACLs(username string, groups []string) {
+	for _, group := range groups {
+		permission, ok := config.Cfg.Auth.LDAP.GroupACLMap[group]
+		if !ok {
+			continue
+		}
+		entry := models.ACLEntry{Username: username, Pattern: "*", Permission: models.Permission(permission)}
+		if err := models.PutACLEntry(entry); err != nil {
+			log.Error().Err(err).Str("username", username).Str("group", group).Msg("failed to apply ldap group acl mapping")
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gemfast/server/internal/models"
+)
+
+// LocalProvider authenticates against the bcrypt-hashed passwords stored
+// directly in BoltDB (admin user, $GEMFAST_ADD_LOCAL_USERS, and anyone
+// who self-registered via RegisterHandler). It's the same check
+// models.AuthenticateLocalUser always did; it's just wrapped in
+// AuthProvider so ChainProvider can try it alongside LDAP/OIDC.
+type LocalProvider struct{}
+
+func NewLocalProvider() *LocalProvider {
+	return &LocalProvider{}
+}
+
+func (p *LocalProvider) Name() string {
+	return "local"
+}
+
+func (p *LocalProvider) Authenticate(ctx context.Context, creds Credentials) (models.User, error) {
+	authenticated, err := models.AuthenticateLocalUser(models.User{Username: creds.Username, Password: []byte(creds.Password)})
+	if err != nil || !authenticated {
+		return models.User{}, fmt.Errorf("invalid username or password")
+	}
+	return models.GetUser(creds.Username)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider authenticates via the same authorization-code flow as
+// OIDCMiddleware (see internal/middleware/oidc.go), but for API clients
+// presenting an already-obtained authorization code (e.g. a CLI that ran
+// its own redirect flow) rather than an admin browser session. The
+// refresh token is persisted on the shadow user's existing
+// OIDCRefreshToken field, the same place OIDCMiddleware stores it, so
+// either path can silently refresh the same federated identity.
+type OIDCProvider struct {
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauth    oauth2.Config
+}
+
+func NewOIDCProvider() (*OIDCProvider, error) {
+	cfg := config.Cfg.Auth
+	ctx := context.Background()
+	provider, err := oidc.NewProvider(ctx, cfg.OIDCIssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch oidc discovery document: %w", err)
+	}
+	return &OIDCProvider{
+		provider: provider,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.OIDCClientId}),
+		oauth: oauth2.Config{
+			ClientID:     cfg.OIDCClientId,
+			ClientSecret: cfg.OIDCClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+	}, nil
+}
+
+func (p *OIDCProvider) Name() string {
+	return "oidc"
+}
+
+func (p *OIDCProvider) Authenticate(ctx context.Context, creds Credentials) (models.User, error) {
+	oauth2Token, err := p.oauth.Exchange(ctx, creds.Code)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to exchange oidc authorization code: %w", err)
+	}
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		return models.User{}, fmt.Errorf("no id_token returned by provider")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to verify oidc id_token: %w", err)
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := idToken.Claims(&claims); err != nil || claims.Subject == "" {
+		return models.User{}, fmt.Errorf("oidc id_token missing sub claim")
+	}
+
+	user, err := EnsureShadowUser(claims.Subject, p.Name())
+	if err != nil {
+		return models.User{}, err
+	}
+	if oauth2Token.RefreshToken != "" && oauth2Token.RefreshToken != user.OIDCRefreshToken {
+		user.OIDCRefreshToken = oauth2Token.RefreshToken
+		if err := models.SetOIDCRefreshToken(user.Username, user.OIDCRefreshToken); err != nil {
+			return models.User{}, err
+		}
+	}
+	return user, nil
+}
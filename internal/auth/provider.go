@@ -0,0 +1,123 @@
+// Package auth defines a pluggable authentication backend abstraction so
+// gemfast can authenticate pushes/logins against local bcrypt passwords,
+// an LDAP directory, or an OIDC provider uniformly, and chain several of
+// them together.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Credentials is the union of everything a provider might need: local and
+// LDAP use Username/Password, OIDC uses Code (the authorization code from
+// its redirect callback). A provider ignores the fields it doesn't use.
+type Credentials struct {
+	Username string
+	Password string
+	Code     string
+}
+
+// AuthProvider authenticates a set of credentials and returns the user
+// they belong to. Implementations that authenticate against an external
+// system (LDAP, OIDC) are expected to create a shadow models.User record
+// on first successful login — see EnsureShadowUser — so the rest of
+// gemfast (CreateUserToken, the ACL system) keeps working uniformly
+// regardless of which provider vouched for the user.
+type AuthProvider interface {
+	Authenticate(ctx context.Context, creds Credentials) (models.User, error)
+	Name() string
+}
+
+// ChainProvider tries each of its providers in order, returning the user
+// from the first one that successfully authenticates creds. It is itself
+// an AuthProvider so it can be handed to the same callers a single
+// provider would be.
+type ChainProvider struct {
+	providers []AuthProvider
+}
+
+// NewChainProvider builds a ChainProvider that tries providers in the
+// given order.
+func NewChainProvider(providers ...AuthProvider) *ChainProvider {
+	return &ChainProvider{providers: providers}
+}
+
+// NewChainProviderFromConfig builds a ChainProvider from
+// config.Env.AuthProviders, a comma-separated ordered list of provider
+// names ("local", "ldap", "oidc"), e.g. "ldap,local" to prefer the
+// directory but still allow local accounts as a fallback. A name with no
+// corresponding provider is rejected so a typo in the env var fails loud
+// at startup rather than silently never trying that backend.
+func NewChainProviderFromConfig() (*ChainProvider, error) {
+	var providers []AuthProvider
+	for _, name := range strings.Split(config.Env.AuthProviders, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case "local":
+			providers = append(providers, NewLocalProvider())
+		case "ldap":
+			providers = append(providers, NewLDAPProvider())
+		case "oidc":
+			p, err := NewOIDCProvider()
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize oidc auth provider: %w", err)
+			}
+			providers = append(providers, p)
+		default:
+			return nil, fmt.Errorf("unknown auth provider %q in config.Env.AuthProviders", name)
+		}
+	}
+	return NewChainProvider(providers...), nil
+}
+
+func (c *ChainProvider) Name() string {
+	return "chain"
+}
+
+// Authenticate tries each provider in order and returns the first
+// successful result. A provider rejecting creds (wrong password, no such
+// ldap entry, …) is expected and only logged at debug level; c returns an
+// error itself only once every provider has rejected creds.
+func (c *ChainProvider) Authenticate(ctx context.Context, creds Credentials) (models.User, error) {
+	var lastErr error
+	for _, p := range c.providers {
+		user, err := p.Authenticate(ctx, creds)
+		if err == nil {
+			return user, nil
+		}
+		log.Debug().Err(err).Str("provider", p.Name()).Msg("auth provider rejected credentials, trying next")
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no auth providers configured")
+	}
+	return models.User{}, fmt.Errorf("no configured auth provider accepted the credentials: %w", lastErr)
+}
+
+// EnsureShadowUser returns the existing user record for username, or
+// creates an empty-password one tagged with providerName if this is its
+// first login through that provider. Called by LDAPProvider and
+// OIDCProvider after they've independently verified the caller's
+// identity; it never itself authenticates anything.
+func EnsureShadowUser(username, providerName string) (models.User, error) {
+	existing, err := models.GetUser(username)
+	if err != nil {
+		return models.User{}, err
+	}
+	if existing.Username != "" {
+		return existing, nil
+	}
+	if err := models.CreateShadowUser(username, providerName); err != nil {
+		return models.User{}, err
+	}
+	return models.GetUser(username)
+}
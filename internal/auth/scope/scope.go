@@ -0,0 +1,128 @@
+package scope
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// Scope is a structured claim embedded in a minted JWT alongside the
+// existing role claim. It lets a token be restricted to a subset of the
+// gems and actions its role would otherwise allow.
+type Scope interface {
+	// Type returns the discriminator stored in the `type` field of the
+	// serialized claim, e.g. "gem" or "admin".
+	Type() string
+	// Allows reports whether the scope permits performing action (e.g.
+	// "read" or "push") against the given gem name.
+	Allows(gemName string, action string) bool
+}
+
+// GemScope restricts a token to a set of gem name glob patterns and a
+// set of allowed actions, e.g. {"type":"gem","names":["mylib","mylib-*"],"actions":["read","push"]}.
+type GemScope struct {
+	Names   []string `json:"names"`
+	Actions []string `json:"actions"`
+}
+
+func (s *GemScope) Type() string { return "gem" }
+
+func (s *GemScope) Allows(gemName string, action string) bool {
+	actionAllowed := false
+	for _, a := range s.Actions {
+		if a == action {
+			actionAllowed = true
+			break
+		}
+	}
+	if !actionAllowed {
+		return false
+	}
+	for _, pattern := range s.Names {
+		if ok, _ := filepath.Match(pattern, gemName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminScope grants unrestricted access, mirroring the existing admin role.
+type AdminScope struct{}
+
+func (s *AdminScope) Type() string                            { return "admin" }
+func (s *AdminScope) Allows(gemName string, action string) bool { return true }
+
+// ReadOnlyScope allows the "read" action against any gem but never "push"
+// or "yank". Used for tokens minted for CI consumers that only install gems.
+type ReadOnlyScope struct{}
+
+func (s *ReadOnlyScope) Type() string { return "read-only" }
+
+func (s *ReadOnlyScope) Allows(gemName string, action string) bool {
+	return action == "read"
+}
+
+// spec is the on-the-wire / JWT-claim shape a scope is parsed from.
+type spec struct {
+	Type    string   `json:"type"`
+	Names   []string `json:"names,omitempty"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+// Parse builds a Scope from a JSON scope spec, such as the body of an
+// admin POST /token request or the `scope` claim of a minted JWT.
+func Parse(raw []byte) (Scope, error) {
+	var s spec
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse scope: %w", err)
+	}
+	return FromSpec(s.Type, s.Names, s.Actions)
+}
+
+// FromMap builds a Scope from a decoded JWT claim map.
+func FromMap(m map[string]interface{}) (Scope, error) {
+	t, _ := m["type"].(string)
+	var names []string
+	if raw, ok := m["names"].([]interface{}); ok {
+		for _, n := range raw {
+			if s, ok := n.(string); ok {
+				names = append(names, s)
+			}
+		}
+	}
+	var actions []string
+	if raw, ok := m["actions"].([]interface{}); ok {
+		for _, a := range raw {
+			if s, ok := a.(string); ok {
+				actions = append(actions, s)
+			}
+		}
+	}
+	return FromSpec(t, names, actions)
+}
+
+func FromSpec(scopeType string, names []string, actions []string) (Scope, error) {
+	switch scopeType {
+	case "admin":
+		return &AdminScope{}, nil
+	case "read-only":
+		return &ReadOnlyScope{}, nil
+	case "gem":
+		if len(names) == 0 || len(actions) == 0 {
+			return nil, fmt.Errorf("gem scope requires both names and actions")
+		}
+		return &GemScope{Names: names, Actions: actions}, nil
+	default:
+		return nil, fmt.Errorf("unknown scope type: %s", scopeType)
+	}
+}
+
+// ToClaims serializes a Scope back into the map shape stored in a JWT claim.
+func ToClaims(s Scope) map[string]interface{} {
+	claims := map[string]interface{}{"type": s.Type()}
+	if gs, ok := s.(*GemScope); ok {
+		claims["names"] = gs.Names
+		claims["actions"] = gs.Actions
+	}
+	return claims
+}
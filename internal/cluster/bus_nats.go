@@ -0,0 +1,36 @@
+package cluster
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsBus implements Bus over a single NATS connection.
+type natsBus struct {
+	conn *nats.Conn
+}
+
+func newNATSBus(url string) (*natsBus, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	return &natsBus{conn: conn}, nil
+}
+
+func (b *natsBus) Publish(_ context.Context, topic string, payload []byte) error {
+	return b.conn.Publish(topic, payload)
+}
+
+func (b *natsBus) Subscribe(_ context.Context, topic string, handler func([]byte)) error {
+	_, err := b.conn.Subscribe(topic, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	return err
+}
+
+func (b *natsBus) Close() error {
+	b.conn.Close()
+	return nil
+}
@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisBus implements Bus over Redis pub/sub, for operators who already
+// run Redis (e.g. for middleware.RateLimiter) but don't want to stand up
+// NATS as well.
+type redisBus struct {
+	client *redis.Client
+}
+
+func newRedisBus(url string) (*redisBus, error) {
+	return &redisBus{client: redis.NewClient(&redis.Options{Addr: url})}, nil
+}
+
+func (b *redisBus) Publish(ctx context.Context, topic string, payload []byte) error {
+	return b.client.Publish(ctx, topic, payload).Err()
+}
+
+func (b *redisBus) Subscribe(ctx context.Context, topic string, handler func([]byte)) error {
+	sub := b.client.Subscribe(ctx, topic)
+	ch := sub.Channel()
+	go func() {
+		for msg := range ch {
+			handler([]byte(msg.Payload))
+		}
+	}()
+	return nil
+}
+
+func (b *redisBus) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,79 @@
+// Package cluster lets multiple gemfast replicas coordinate: a pub/sub
+// bus carries index-invalidation events and peer heartbeats, a lease held
+// in the shared db.Store elects a single leader to run the periodic tasks
+// start() otherwise runs on every replica, and /admin/api/v1/cluster/peers
+// reports what the cluster currently looks like.
+//
+// The metadata store (GEM_DEPENDENCY_BUCKET, users, tokens) and gem blobs
+// themselves are expected to already live behind shared backends by the
+// time cluster mode is enabled — a PostgreSQL db.Store and the
+// internal/storage object-storage backend respectively — so this package
+// only owns the coordination layer on top of them.
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Bus is the gossip/pubsub transport used for index invalidation and peer
+// heartbeats. NewBus picks an implementation based on
+// config.Cfg.Cluster.Backend ("nats" or "redis") so an operator can reuse
+// whichever they already run.
+type Bus interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	Subscribe(ctx context.Context, topic string, handler func([]byte)) error
+	Close() error
+}
+
+var bus Bus
+
+// Init wires up the cluster bus and starts the heartbeat/leader-election
+// loops. It's a no-op when config.Cfg.Cluster.Enabled is false, so
+// single-node deployments pay nothing extra.
+func Init() error {
+	if !config.Cfg.Cluster.Enabled {
+		return nil
+	}
+	b, err := newBus(config.Cfg.Cluster.Backend)
+	if err != nil {
+		return fmt.Errorf("failed to initialize cluster bus: %w", err)
+	}
+	bus = b
+	if err := bus.Subscribe(context.Background(), invalidationTopic, handleInvalidation); err != nil {
+		return fmt.Errorf("failed to subscribe to index invalidation topic: %w", err)
+	}
+	if err := bus.Subscribe(context.Background(), heartbeatTopic, handleHeartbeat); err != nil {
+		return fmt.Errorf("failed to subscribe to peer heartbeat topic: %w", err)
+	}
+	startHeartbeatLoop(context.Background())
+	startElectionLoop(context.Background())
+	log.Info().Str("backend", config.Cfg.Cluster.Backend).Msg("cluster mode enabled")
+	return nil
+}
+
+func newBus(backend string) (Bus, error) {
+	switch backend {
+	case "nats":
+		return newNATSBus(config.Cfg.Cluster.NATS.URL)
+	case "redis":
+		return newRedisBus(config.Cfg.Cluster.Redis.URL)
+	default:
+		return nil, fmt.Errorf("unknown cluster.backend %q", backend)
+	}
+}
+
+// Enabled reports whether cluster mode is active; IsLeader uses it to treat
+// a single-node deployment as always being the leader.
+func Enabled() bool {
+	return config.Cfg.Cluster.Enabled
+}
+
+const (
+	heartbeatInterval = 5 * time.Second
+	peerTTL           = 3 * heartbeatInterval
+)
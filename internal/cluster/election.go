@@ -0,0 +1,79 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/db"
+
+	"github.com/rs/zerolog/log"
+)
+
+// leaseTTL is how long a held leadership lease is valid for before
+// another node may claim it; renewInterval is comfortably shorter so a
+// live leader never lets its own lease lapse.
+const (
+	leaseTTL      = 15 * time.Second
+	renewInterval = 5 * time.Second
+	leaseKey      = "cluster_leader"
+)
+
+var (
+	leaderMu sync.RWMutex
+	isLeader bool
+)
+
+// IsLeader reports whether this node currently holds the cluster
+// leadership lease. Single-node (cluster disabled) deployments are
+// always considered the leader, so callers can gate a task on IsLeader()
+// unconditionally.
+func IsLeader() bool {
+	if !Enabled() {
+		return true
+	}
+	leaderMu.RLock()
+	defer leaderMu.RUnlock()
+	return isLeader
+}
+
+func startElectionLoop(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(renewInterval)
+		defer ticker.Stop()
+		tryAcquireOrRenewLease()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				tryAcquireOrRenewLease()
+			}
+		}
+	}()
+}
+
+// tryAcquireOrRenewLease attempts to claim or renew this node's leadership
+// lease through db.Store, the shared metadata store every replica points
+// at in cluster mode (see package doc). A node-local db.BoltDB lease
+// would let every replica win its own empty bucket and believe itself
+// leader, running the leader-only periodic tasks (cve.InitRubyAdvisoryDB,
+// index regen, mirror prewarm) on every node instead of just one.
+func tryAcquireOrRenewLease() {
+	nodeID := config.Cfg.Cluster.NodeID
+	acquired, err := db.Store.TryAcquireLease(context.Background(), leaseKey, nodeID, leaseTTL)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to acquire or renew cluster leadership lease")
+		acquired = false
+	}
+	leaderMu.Lock()
+	wasLeader := isLeader
+	isLeader = acquired
+	leaderMu.Unlock()
+	if acquired && !wasLeader {
+		log.Info().Str("node", nodeID).Msg("acquired cluster leadership")
+	} else if !acquired && wasLeader {
+		log.Warn().Str("node", nodeID).Msg("lost cluster leadership")
+	}
+}
@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gemfast/server/internal/indexer"
+	"github.com/rs/zerolog/log"
+)
+
+const invalidationTopic = "gemfast.index.invalidate"
+
+type invalidationEvent struct {
+	Generation int64  `json:"generation"`
+	Gem        string `json:"gem"`
+}
+
+var localGeneration int64
+
+// PublishIndexInvalidation tells every other replica that gem was added
+// (by mirroredGemHandler or localUploadGemHandler on this node) so they
+// can refresh their own in-memory index instead of waiting for their next
+// full regeneration.
+func PublishIndexInvalidation(gem string) {
+	if bus == nil {
+		return
+	}
+	localGeneration++
+	payload, err := json.Marshal(invalidationEvent{Generation: localGeneration, Gem: gem})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal index invalidation event")
+		return
+	}
+	if err := bus.Publish(context.Background(), invalidationTopic, payload); err != nil {
+		log.Error().Err(err).Msg("failed to publish index invalidation event")
+	}
+}
+
+func handleInvalidation(payload []byte) {
+	var evt invalidationEvent
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal index invalidation event")
+		return
+	}
+	if evt.Generation <= localGeneration {
+		return
+	}
+	localGeneration = evt.Generation
+	log.Info().Str("gem", evt.Gem).Int64("generation", evt.Generation).Msg("invalidating local index after peer upload")
+	if err := indexer.Get().ReloadIndex(); err != nil {
+		log.Error().Err(err).Msg("failed to reload index after peer invalidation")
+	}
+}
+
+// Generation returns this node's last-seen index generation, reported by
+// PeersHandler.
+func Generation() int64 {
+	return localGeneration
+}
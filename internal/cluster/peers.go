@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const heartbeatTopic = "gemfast.cluster.heartbeat"
+
+// Peer is what each replica gossips about itself and what PeersHandler
+// reports back.
+type Peer struct {
+	ID              string    `json:"id"`
+	Address         string    `json:"address"`
+	LastSeen        time.Time `json:"last_seen"`
+	IndexGeneration int64     `json:"index_generation"`
+	Leader          bool      `json:"leader"`
+}
+
+var (
+	peersMu sync.Mutex
+	peers   = map[string]Peer{}
+)
+
+func startHeartbeatLoop(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		publishHeartbeat()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				publishHeartbeat()
+				evictStalePeers()
+			}
+		}
+	}()
+}
+
+func publishHeartbeat() {
+	self := Peer{
+		ID:              config.Cfg.Cluster.NodeID,
+		Address:         config.Cfg.Cluster.AdvertiseAddr,
+		LastSeen:        time.Now(),
+		IndexGeneration: Generation(),
+		Leader:          IsLeader(),
+	}
+	recordPeer(self)
+	payload, err := json.Marshal(self)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal cluster heartbeat")
+		return
+	}
+	if err := bus.Publish(context.Background(), heartbeatTopic, payload); err != nil {
+		log.Error().Err(err).Msg("failed to publish cluster heartbeat")
+	}
+}
+
+func handleHeartbeat(payload []byte) {
+	var p Peer
+	if err := json.Unmarshal(payload, &p); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal cluster heartbeat")
+		return
+	}
+	recordPeer(p)
+}
+
+func recordPeer(p Peer) {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	peers[p.ID] = p
+}
+
+func evictStalePeers() {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	cutoff := time.Now().Add(-peerTTL)
+	for id, p := range peers {
+		if p.LastSeen.Before(cutoff) {
+			delete(peers, id)
+		}
+	}
+}
+
+// PeersHandler is the admin endpoint reporting peer health and last-seen
+// index generation for the whole cluster.
+func PeersHandler(c *gin.Context) {
+	peersMu.Lock()
+	snapshot := make([]Peer, 0, len(peers))
+	for _, p := range peers {
+		snapshot = append(snapshot, p)
+	}
+	peersMu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"peers": snapshot})
+}
@@ -0,0 +1,51 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/gemfast/server/internal/compactindex"
+	"github.com/gemfast/server/internal/cve"
+	"github.com/gemfast/server/internal/indexer"
+
+	"github.com/rs/zerolog/log"
+)
+
+// leaderTaskInterval is how often the leader re-runs the periodic
+// maintenance tasks that used to run unconditionally in start() on every
+// replica.
+const leaderTaskInterval = 10 * time.Minute
+
+// StartLeaderWorker runs cve.InitRubyAdvisoryDB, a full index
+// regeneration, and a compact index rebuild on a timer, but only on
+// whichever node currently holds cluster leadership, so a 5-replica
+// deployment does this work once instead of five times. On a single-node
+// deployment (cluster mode disabled) IsLeader is always true, so this is
+// equivalent to start()'s old unconditional calls.
+func StartLeaderWorker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(leaderTaskInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runLeaderTasksIfLeader()
+			}
+		}
+	}()
+}
+
+func runLeaderTasksIfLeader() {
+	if !IsLeader() {
+		return
+	}
+	log.Info().Msg("running leader-only maintenance tasks")
+	cve.InitRubyAdvisoryDB()
+	if err := indexer.Get().GenerateIndex(); err != nil {
+		log.Error().Err(err).Msg("leader failed to regenerate index")
+		return
+	}
+	compactindex.Rebuild()
+}
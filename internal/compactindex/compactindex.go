@@ -0,0 +1,226 @@
+// Package compactindex generates and serves the three files that make up
+// Bundler's "compact index" protocol (/names, /versions, /info/<gem>),
+// which Bundler prefers over the legacy Marshal.4.8 specs dump because it
+// supports incremental, range-based fetches instead of downloading the
+// full index on every resolve.
+package compactindex
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	namesFile    = "names"
+	versionsFile = "versions.list"
+	infoDir      = "info"
+)
+
+var mu sync.Mutex
+
+func dir() string {
+	return filepath.Join(config.Env.Dir, "compact_index")
+}
+
+// checksum returns the hex-encoded MD5 of content, the line-level
+// integrity check versions.list embeds for its corresponding /info file.
+func checksum(content []byte) string {
+	sum := md5.Sum(content)
+	return fmt.Sprintf("%x", sum)
+}
+
+// gemChecksum returns the hex-encoded SHA256 of a .gem file's bytes, the
+// `checksum:` field Bundler's compact index client verifies a downloaded
+// gem against before installing it.
+func gemChecksum(gemBytes []byte) string {
+	sum := sha256.Sum256(gemBytes)
+	return fmt.Sprintf("%x", sum)
+}
+
+// GenerateNames (re)writes the /names file: a sorted, newline-separated
+// list of every gem name known to this server, local and mirrored.
+func GenerateNames(gemNames []string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(dir(), 0755); err != nil {
+		return fmt.Errorf("compactindex: failed to create index dir: %w", err)
+	}
+	sorted := append([]string(nil), gemNames...)
+	sort.Strings(sorted)
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, name := range sorted {
+		b.WriteString(name)
+		b.WriteString("\n")
+	}
+	return os.WriteFile(filepath.Join(dir(), namesFile), []byte(b.String()), 0644)
+}
+
+// ensureVersionsHeader writes the header once at the top of versions.list
+// and never rewrites it; subsequent gem releases are appended as new lines
+// so the file stays useful for incremental (range) fetches.
+func ensureVersionsHeader() error {
+	path := filepath.Join(dir(), versionsFile)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir(), 0755); err != nil {
+		return err
+	}
+	header := fmt.Sprintf("created_at: %s\n---\n", time.Now().UTC().Format(time.RFC3339))
+	return os.WriteFile(path, []byte(header), 0644)
+}
+
+// versionString renders a Gem's version with its platform suffix, e.g.
+// "1.0.0" or "1.0.0-java", the form both /info and versions.list use.
+func versionString(g models.Gem) string {
+	v := g.Number
+	if g.Platform != "" && g.Platform != "ruby" {
+		v += "-" + g.Platform
+	}
+	return v
+}
+
+// GemVersionInfo carries everything a newly indexed gem version needs to
+// be persisted and rendered into a compact-index /info line: the runtime
+// dependencies, and ruby/rubygems requirements declared in its gemspec.
+type GemVersionInfo struct {
+	Name                    string
+	Version                 string
+	Platform                string
+	Dependencies            []models.GemDependency
+	RequiredRubyVersion     string
+	RequiredRubygemsVersion string
+}
+
+// AppendVersion persists a newly indexed gem version together with the
+// sha256 checksum of gemBytes, replacing any stored entry with the same
+// name/version/platform, so the next GenerateInfo call can render it as a real compact-index
+// /info line instead of a bare version number.
+func AppendVersion(info GemVersionInfo, gemBytes []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+	gem := models.Gem{
+		Name:                    info.Name,
+		Number:                  info.Version,
+		Platform:                info.Platform,
+		Dependencies:            info.Dependencies,
+		Checksum:                gemChecksum(gemBytes),
+		RequiredRubyVersion:     info.RequiredRubyVersion,
+		RequiredRubygemsVersion: info.RequiredRubygemsVersion,
+	}
+	if err := models.PutGem(gem); err != nil {
+		return fmt.Errorf("compactindex: failed to persist gem version: %w", err)
+	}
+	return nil
+}
+
+// GenerateInfo (re)writes /info/<gemName>: one line per released version
+// describing its runtime dependencies, checksum, and ruby/rubygems
+// requirements, in the format Bundler's compact index client expects.
+// It then appends a versions.list line aggregating every known version
+// of gemName against the MD5 of the /info file it just wrote, so Bundler
+// knows to re-fetch /info/<gemName> whenever that line's hash changes.
+func GenerateInfo(gemName string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	gems, err := models.GetGem(gemName)
+	if err != nil {
+		return fmt.Errorf("compactindex: failed to load versions for %s: %w", gemName, err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir(), infoDir), 0755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, g := range gems {
+		deps := make([]string, len(g.Dependencies))
+		for i, d := range g.Dependencies {
+			deps[i] = fmt.Sprintf("%s:%s", d.Name, d.Requirement)
+		}
+		meta := []string{fmt.Sprintf("checksum:%s", g.Checksum)}
+		if g.RequiredRubyVersion != "" {
+			meta = append(meta, fmt.Sprintf("ruby:%s", g.RequiredRubyVersion))
+		}
+		if g.RequiredRubygemsVersion != "" {
+			meta = append(meta, fmt.Sprintf("rubygems:%s", g.RequiredRubygemsVersion))
+		}
+		fmt.Fprintf(&b, "%s %s|%s\n", versionString(g), strings.Join(deps, ","), strings.Join(meta, ","))
+	}
+	path := filepath.Join(dir(), infoDir, gemName)
+	content := []byte(b.String())
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("compactindex: failed to write info file for %s: %w", gemName, err)
+	}
+	return appendVersionsLine(gemName, gems, content)
+}
+
+// appendVersionsLine appends one `gem version,version,... md5(info file)`
+// line to versions.list, aggregating every version GenerateInfo just
+// rendered into gemName's /info file rather than one line per version,
+// matching the per-gem format Bundler's compact index client expects.
+func appendVersionsLine(gemName string, gems []models.Gem, infoContent []byte) error {
+	if err := ensureVersionsHeader(); err != nil {
+		return fmt.Errorf("compactindex: failed to initialize versions.list: %w", err)
+	}
+	versions := make([]string, len(gems))
+	for i, g := range gems {
+		versions[i] = versionString(g)
+	}
+	line := fmt.Sprintf("%s %s %s\n", gemName, strings.Join(versions, ","), checksum(infoContent))
+	f, err := os.OpenFile(filepath.Join(dir(), versionsFile), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("compactindex: failed to open versions.list: %w", err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(line)
+	return err
+}
+
+// Rebuild regenerates all three compact index files from the current set
+// of indexed gems. Called once at startup so the index survives a restart,
+// and periodically by the cluster leader worker.
+func Rebuild() {
+	gems, err := models.GetGems()
+	if err != nil {
+		log.Warn().Err(err).Msg("compactindex: no gems available to build index from yet")
+		return
+	}
+	names := make(map[string]bool)
+	for _, versions := range gems {
+		for _, g := range versions {
+			names[g.Name] = true
+		}
+	}
+	var nameList []string
+	for name := range names {
+		nameList = append(nameList, name)
+		if err := GenerateInfo(name); err != nil {
+			log.Error().Err(err).Str("gem", name).Msg("failed to regenerate compact index info file")
+		}
+	}
+	if err := GenerateNames(nameList); err != nil {
+		log.Error().Err(err).Msg("failed to regenerate compact index names file")
+	}
+}
+
+// NamesPath, VersionsPath, and InfoPath return the on-disk location of
+// each served file so the gin handlers can stream them with Range/ETag
+// support via http.ServeContent.
+func NamesPath() string { return filepath.Join(dir(), namesFile) }
+
+func VersionsPath() string { return filepath.Join(dir(), versionsFile) }
+
+func InfoPath(gemName string) string { return filepath.Join(dir(), infoDir, gemName) }
@@ -0,0 +1,122 @@
+// Package crypto encrypts sensitive fields (GitHub access tokens,
+// user-minted API tokens, and optionally the JWT signing secret) at rest
+// in BoltDB using JWE, so a leaked Bolt file or backup doesn't hand over
+// live credentials.
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/gemfast/server/internal/config"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/rs/zerolog/log"
+)
+
+const keySize = 2048
+
+// plaintextPrefix marks a value that has not yet been migrated to JWE, so
+// Decrypt can be called unconditionally against records written before
+// encryption-at-rest was introduced.
+const plaintextPrefix = "plain:"
+
+var privateKey *rsa.PrivateKey
+
+// Init loads the RSA key pair from config.Cfg.KeyFile, generating and
+// persisting one on first boot if it doesn't exist yet.
+func Init() error {
+	if config.Cfg.KeyFile == "" {
+		return fmt.Errorf("crypto: config.Cfg.KeyFile is not set")
+	}
+	if _, err := os.Stat(config.Cfg.KeyFile); os.IsNotExist(err) {
+		return generateAndSaveKey(config.Cfg.KeyFile)
+	}
+	return loadKey(config.Cfg.KeyFile)
+}
+
+func generateAndSaveKey(path string) error {
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return fmt.Errorf("crypto: failed to generate key pair: %w", err)
+	}
+	keyBytes := x509.MarshalPKCS1PrivateKey(key)
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: keyBytes}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("crypto: failed to create key file: %w", err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, block); err != nil {
+		return fmt.Errorf("crypto: failed to write key file: %w", err)
+	}
+	privateKey = key
+	log.Info().Str("detail", path).Msg("generated a new token encryption key")
+	return nil
+}
+
+func loadKey(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("crypto: failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return fmt.Errorf("crypto: key file does not contain a PEM block")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("crypto: failed to parse private key: %w", err)
+	}
+	privateKey = key
+	return nil
+}
+
+// Encrypt JWE-encrypts plaintext with RSA-OAEP key wrapping and AES-GCM
+// content encryption, returning the compact serialization.
+func Encrypt(plaintext string) (string, error) {
+	if privateKey == nil {
+		return "", fmt.Errorf("crypto: not initialized, call Init first")
+	}
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP, Key: &privateKey.PublicKey}, nil)
+	if err != nil {
+		return "", fmt.Errorf("crypto: failed to create encrypter: %w", err)
+	}
+	obj, err := encrypter.Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", fmt.Errorf("crypto: failed to encrypt: %w", err)
+	}
+	return obj.CompactSerialize()
+}
+
+// Decrypt reverses Encrypt. A value tagged with plaintextPrefix (see
+// MarkPlaintext) is returned unchanged without the prefix. An untagged
+// value that is not a JWE, such as a raw token stored before
+// encryption-at-rest, returns an error.
+func Decrypt(ciphertext string) (string, error) {
+	if len(ciphertext) >= len(plaintextPrefix) && ciphertext[:len(plaintextPrefix)] == plaintextPrefix {
+		return ciphertext[len(plaintextPrefix):], nil
+	}
+	if privateKey == nil {
+		return "", fmt.Errorf("crypto: not initialized, call Init first")
+	}
+	obj, err := jose.ParseEncrypted(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("crypto: failed to parse jwe: %w", err)
+	}
+	plaintext, err := obj.Decrypt(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("crypto: failed to decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// MarkPlaintext tags a pre-encryption value so Decrypt can pass it through
+// during the lazy migration window.
+func MarkPlaintext(value string) string {
+	return plaintextPrefix + value
+}
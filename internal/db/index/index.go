@@ -0,0 +1,105 @@
+// Package index provides generic secondary-index maintenance on top of
+// BoltDB buckets. Every index bucket stores no value of its own — the key
+// is "attribute\x00primaryKey" and presence of the key is the fact being
+// recorded — so a Cursor().Seek(prefix) walk over an index bucket yields
+// exactly the primary keys matching that attribute, without touching the
+// (potentially much larger) primary bucket at all.
+//
+// Callers are responsible for calling Put/Delete inside the same bbolt
+// transaction as the corresponding primary-bucket write, so the index
+// never observably drifts from the data it indexes.
+package index
+
+import (
+	"strings"
+
+	"github.com/gemfast/server/internal/db"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func key(attribute, primaryKey string) []byte {
+	return []byte(attribute + "\x00" + primaryKey)
+}
+
+// Put records that primaryKey has the given attribute value in
+// indexBucket, e.g. Put(tx, db.USER_BY_EMAIL_IDX, "a@example.com", "alice").
+func Put(tx *bolt.Tx, indexBucket, attribute, primaryKey string) error {
+	return tx.Bucket([]byte(indexBucket)).Put(key(attribute, primaryKey), nil)
+}
+
+// Delete removes a previously-Put index entry. Callers that are
+// overwriting an attribute (e.g. a user changing email) must Delete the
+// old (attribute, primaryKey) pair themselves before Put-ing the new one;
+// Put alone does not know what the prior value was.
+func Delete(tx *bolt.Tx, indexBucket, attribute, primaryKey string) error {
+	return tx.Bucket([]byte(indexBucket)).Delete(key(attribute, primaryKey))
+}
+
+// SeekPrefix returns every primary key indexed under an attribute value
+// beginning with prefix, e.g. SeekPrefix(db.USER_BY_EMAIL_IDX, "alice@") to
+// find every user whose email starts with "alice@". Callers that want an
+// exact attribute match, not merely a prefix, should use SeekExact.
+func SeekPrefix(indexBucket, prefix string) ([]string, error) {
+	var primaryKeys []string
+	rawPrefix := []byte(prefix)
+	err := db.BoltDB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(indexBucket)).Cursor()
+		for k, _ := c.Seek(rawPrefix); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+			parts := strings.SplitN(string(k), "\x00", 2)
+			if len(parts) == 2 {
+				primaryKeys = append(primaryKeys, parts[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return primaryKeys, nil
+}
+
+// SeekExact returns every primary key indexed under exactly attribute,
+// unlike SeekPrefix, which also matches any value attribute is merely a
+// prefix of (e.g. "alice" matching "alice-bot" or "alice2"). Seeking
+// attribute+"\x00" compares through the key delimiter itself, so only an
+// exact attribute value matches.
+func SeekExact(indexBucket, attribute string) ([]string, error) {
+	return SeekPrefix(indexBucket, attribute+"\x00")
+}
+
+// Rebuild clears indexBucket and repopulates it from scratch by calling
+// attributesOf for every key/value in primaryBucket. attributesOf returns
+// the (possibly zero, possibly multiple) attribute values that primary key
+// should be indexed under, e.g. a gem's owner and namespace at once.
+//
+// This is what startup reconciliation calls for every maintained index,
+// so a bucket created before an index existed (or one that drifted due to
+// a bug or a restore from an older backup) self-heals without manual
+// intervention.
+func Rebuild(primaryBucket, indexBucket string, attributesOf func(primaryKey string, value []byte) []string) error {
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(indexBucket)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		idx, err := tx.CreateBucket([]byte(indexBucket))
+		if err != nil {
+			return err
+		}
+		primary := tx.Bucket([]byte(primaryBucket))
+		if primary == nil {
+			return nil
+		}
+		return primary.ForEach(func(k, v []byte) error {
+			for _, attr := range attributesOf(string(k), v) {
+				if attr == "" {
+					continue
+				}
+				if err := idx.Put(key(attr, string(k)), nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gemfast/server/internal/apierr"
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/cve"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cveProblem renders the blocked CVE as an RFC 7807 problem so clients can
+// see which advisory tripped the block and what versions are patched.
+func cveProblem(c *gin.Context, advisory cve.GemAdvisory) {
+	c.Header("Content-Type", apierr.ContentType)
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"type":             "https://gemfast.dev/problems/vulnerable-gem",
+		"title":            "Refusing to serve a gem with a known vulnerability",
+		"status":           http.StatusForbidden,
+		"cve_id":           advisory.Cve,
+		"cvss_v3":          advisory.CvssV3,
+		"cvss_v2":          advisory.CvssV2,
+		"url":              advisory.URL,
+		"patched_versions": advisory.PatchedVersions,
+	})
+}
+
+// NewCVEDownloadMiddleware blocks downloads of gem versions with a known
+// advisory when cve.block_downloads is enabled, based on the :gem or
+// :gemspec.rz route param used by /gems/:gem and
+// /quick/Marshal.4.8/:gemspec.rz.
+func NewCVEDownloadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.Cfg.CVE.Enabled || !config.Cfg.CVE.BlockDownloads {
+			return
+		}
+		fileName := c.Param("gem")
+		if fileName == "" {
+			fileName = c.Param("gemspec.rz")
+		}
+		if fileName == "" {
+			return
+		}
+		g := models.GemFromGemParameter(fileName)
+		advisories := cve.GetCVEs(g.Name, g.Number)
+		if len(advisories) > 0 {
+			cveProblem(c, advisories[0])
+			return
+		}
+	}
+}
+
+// CheckUploadCVEs is called on an uploaded gem before it is saved or added
+// to the index. When cve.block_uploads is enabled and the gem has an
+// unpatched advisory, it returns the offending advisory so the handler can
+// reject the upload; otherwise it returns nil.
+func CheckUploadCVEs(gemName, version string) *cve.GemAdvisory {
+	if !config.Cfg.CVE.Enabled || !config.Cfg.CVE.BlockUploads {
+		return nil
+	}
+	advisories := cve.GetCVEs(gemName, version)
+	if len(advisories) == 0 {
+		return nil
+	}
+	return &advisories[0]
+}
+
+// CVEsForGemHandler is an admin endpoint exposing the cached advisory list
+// for a stored gem so operators can audit what's sitting in their index.
+func CVEsForGemHandler(c *gin.Context) {
+	gemName := c.Param("gem")
+	gems, err := models.GetGem(gemName)
+	if err != nil {
+		c.String(http.StatusNotFound, "gem %s not found", gemName)
+		return
+	}
+	type versionCVEs struct {
+		Version string            `json:"version"`
+		CVEs    []cve.GemAdvisory `json:"cves"`
+	}
+	var result []versionCVEs
+	for _, g := range gems {
+		result = append(result, versionCVEs{Version: g.Number, CVEs: cve.GetCVEs(gemName, g.Number)})
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultGemACLPermission is what applies when a user has no ACL entries
+// at all, including no "*" default rule — it preserves today's behavior
+// (any authenticated user can read/write any gem) so configuring ACLs is
+// opt-in per user rather than a breaking default-deny change.
+const defaultGemACLPermission = models.ReadWrite
+
+// AuthorizeGemRead and AuthorizeGemWrite are called the same way
+// AuthorizeScope is: true when there's no authenticated user to check
+// (scope/ACL enforcement only applies once a user is known), false when
+// the user's per-gem ACL denies the action.
+func AuthorizeGemRead(c *gin.Context, gemName string) bool {
+	username := usernameFromContext(c)
+	if username == "" {
+		return true
+	}
+	return models.CanRead(models.AuthorizeGem(username, gemName, defaultGemACLPermission))
+}
+
+func AuthorizeGemWrite(c *gin.Context, gemName string) bool {
+	username := usernameFromContext(c)
+	if username == "" {
+		return true
+	}
+	return models.CanWrite(models.AuthorizeGem(username, gemName, defaultGemACLPermission))
+}
+
+// aclEntryRequest is the body accepted by the admin ACL CRUD routes.
+type aclEntryRequest struct {
+	Pattern    string            `json:"pattern" binding:"required"`
+	Permission models.Permission `json:"permission" binding:"required"`
+}
+
+// ListACLHandler returns every rule configured for :user.
+func ListACLHandler(c *gin.Context) {
+	username := c.Param("user")
+	entries, err := models.GetACLEntries(username)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read acl entries")
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// PutACLHandler creates or replaces a single (user, pattern) rule.
+func PutACLHandler(c *gin.Context) {
+	username := c.Param("user")
+	var req aclEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "pattern and permission are required")
+		return
+	}
+	entry := models.ACLEntry{Username: username, Pattern: req.Pattern, Permission: req.Permission}
+	if err := models.PutACLEntry(entry); err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("failed to save acl entry: %s", err))
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// DeleteACLHandler removes a single (user, pattern) rule, identified by
+// the ?pattern= query parameter since the pattern itself may contain
+// slashes or other characters awkward in a route segment.
+func DeleteACLHandler(c *gin.Context) {
+	username := c.Param("user")
+	pattern := c.Query("pattern")
+	if pattern == "" {
+		c.String(http.StatusBadRequest, "must provide a pattern query parameter")
+		return
+	}
+	if err := models.DeleteACLEntry(username, pattern); err != nil {
+		c.String(http.StatusInternalServerError, "failed to delete acl entry")
+		return
+	}
+	c.String(http.StatusOK, "deleted")
+}
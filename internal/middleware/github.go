@@ -11,7 +11,9 @@ import (
 	"time"
 
 	jmw "github.com/appleboy/gin-jwt/v2"
+	"github.com/gemfast/server/internal/apierr"
 	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/crypto"
 	"github.com/gemfast/server/internal/db"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -121,8 +123,7 @@ func (m *GitHubMiddleware) GitHubCallbackHandler(c *gin.Context) {
 	req, err := http.NewRequest("POST", "https://github.com/login/oauth/access_token", bodyReader)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to create POST login/oauth/access_token request")
-		c.String(http.StatusInternalServerError, "failed to create POST login/oauth/access_token request")
-		c.Abort()
+		apierr.Write(c, apierr.InternalError.WithInstance(c.FullPath()).WithDetail("failed to create POST login/oauth/access_token request"))
 		return
 	}
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
@@ -130,16 +131,14 @@ func (m *GitHubMiddleware) GitHubCallbackHandler(c *gin.Context) {
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get an access token from github")
-		c.String(http.StatusInternalServerError, "failed to get an access token from github")
-		c.Abort()
+		apierr.Write(c, apierr.InternalError.WithInstance(c.FullPath()).WithDetail("failed to get an access token from github"))
 		return
 	}
 	defer res.Body.Close()
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to read POST login/oauth/access_token response from github")
-		c.String(http.StatusForbidden, "failed to read response of access token request")
-		c.Abort()
+		apierr.Write(c, apierr.Unauthorized.WithInstance(c.FullPath()).WithDetail("failed to read response of access token request"))
 		return
 	}
 	json := string(body)
@@ -147,8 +146,7 @@ func (m *GitHubMiddleware) GitHubCallbackHandler(c *gin.Context) {
 	user, err := m.authenticateGitHubUser(at)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to authenticate github user")
-		c.String(http.StatusForbidden, fmt.Sprintf("failed to fetch github user with provided token: %v", err))
-		c.Abort()
+		apierr.Write(c, apierr.Unauthorized.WithInstance(c.FullPath()).WithDetail(fmt.Sprintf("failed to fetch github user with provided token: %v", err)))
 		return
 	}
 	ed := gjson.Get(json, "error_description").String()
@@ -156,8 +154,7 @@ func (m *GitHubMiddleware) GitHubCallbackHandler(c *gin.Context) {
 	jwt, _, err := m.generateJWTToken(user)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to generate JWT token")
-		c.String(http.StatusInternalServerError, "failed to generate JWT token")
-		c.Abort()
+		apierr.Write(c, apierr.InternalError.WithInstance(c.FullPath()).WithDetail("failed to generate JWT token"))
 		return
 	}
 	c.HTML(http.StatusOK, "github/callback.tmpl", gin.H{
@@ -193,21 +190,31 @@ func (m *GitHubMiddleware) authenticateGitHubUser(at string) (*db.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	user, err := m.db.GetUser(username)
+	user, getErr := m.db.GetUser(username)
+	encryptedToken, err := crypto.Encrypt(at)
 	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt github access token for storage: %w", err)
+	}
+	if getErr != nil {
 		newUser := &db.User{
 			Username:    username,
 			Role:        m.cfg.Auth.DefaultUserRole,
 			Type:        "github",
-			GitHubToken: at,
+			GitHubToken: encryptedToken,
 		}
 		err = m.db.CreateUser(newUser)
 		if err != nil {
 			return nil, err
 		}
 		return newUser, nil
-	} else if user.GitHubToken != at {
-		user.GitHubToken = at
+	}
+	storedToken, err := crypto.Decrypt(user.GitHubToken)
+	if err != nil {
+		// Pre-encryption records stored the raw access token directly.
+		storedToken = user.GitHubToken
+	}
+	if storedToken != at {
+		user.GitHubToken = encryptedToken
 		err = m.db.UpdateUser(user)
 		if err != nil {
 			return nil, err
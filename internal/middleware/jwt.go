@@ -3,6 +3,7 @@ package middleware
 import (
 	"time"
 
+	"github.com/gemfast/server/internal/apierr"
 	"github.com/gemfast/server/internal/config"
 	"github.com/gemfast/server/internal/models"
 
@@ -21,10 +22,14 @@ const RoleKey = "role"
 
 func NewJwtMiddleware() (*jmw.GinJWTMiddleware, error) {
 	authMiddleware, err := jmw.New(&jmw.GinJWTMiddleware{
-		Realm:       "zone",
-		Key:         []byte(config.Cfg.Auth.JWTSecretKey),
-		Timeout:     time.Hour * 12,
-		MaxRefresh:  time.Hour * 24,
+		Realm: "zone",
+		Key:   []byte(config.Cfg.Auth.JWTSecretKey),
+		// Access tokens are now intentionally short-lived; long-lived
+		// sessions are carried by the opaque, revocable refresh tokens
+		// issued alongside them (see refresh.go) rather than by MaxRefresh
+		// re-signing the same JWT.
+		Timeout:     time.Minute * 15,
+		MaxRefresh:  time.Minute * 15,
 		IdentityKey: IdentityKey,
 		PayloadFunc: func(data interface{}) jmw.MapClaims {
 			if v, ok := data.(models.User); ok {
@@ -70,9 +75,21 @@ func NewJwtMiddleware() (*jmw.GinJWTMiddleware, error) {
 			return ok
 		},
 		Unauthorized: func(c *gin.Context, code int, message string) {
+			apierr.Write(c, apierr.Unauthorized.WithInstance(c.FullPath()).WithDetail(message))
+		},
+		LoginResponse: func(c *gin.Context, code int, token string, expire time.Time) {
+			claims := jmw.ExtractClaims(c)
+			username, _ := claims[IdentityKey].(string)
+			refreshToken, err := IssueRefreshToken(username)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to issue refresh token")
+				c.JSON(code, gin.H{"token": token, "expire": expire.Format(time.RFC3339)})
+				return
+			}
 			c.JSON(code, gin.H{
-				"code":    code,
-				"message": message,
+				"token":         token,
+				"expire":        expire.Format(time.RFC3339),
+				"refresh_token": refreshToken,
 			})
 		},
 		TokenLookup:   "header: Authorization",
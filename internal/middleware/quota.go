@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/db"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// downloadQuota is what's persisted in db.DOWNLOAD_QUOTA_BUCKET, keyed by
+// username. BytesUsed resets to 0 the first time it's touched in a new
+// calendar month (PeriodStart rolls forward), so there's no separate
+// cron job to reset it.
+type downloadQuota struct {
+	BytesUsed   int64     `json:"bytes_used"`
+	PeriodStart time.Time `json:"period_start"`
+}
+
+func currentMonthStart() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func getDownloadQuota(username string) (downloadQuota, error) {
+	var q downloadQuota
+	err := db.BoltDB.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket([]byte(db.DOWNLOAD_QUOTA_BUCKET)).Get([]byte(username))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &q)
+	})
+	if q.PeriodStart.Before(currentMonthStart()) {
+		q = downloadQuota{PeriodStart: currentMonthStart()}
+	}
+	return q, err
+}
+
+func putDownloadQuota(username string, q downloadQuota) error {
+	raw, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(db.DOWNLOAD_QUOTA_BUCKET)).Put([]byte(username), raw)
+	})
+}
+
+// quotaCountingWriter wraps gin's ResponseWriter so the bytes actually
+// streamed back to the client (not just the file size on disk) are what
+// get charged against the quota.
+type quotaCountingWriter struct {
+	gin.ResponseWriter
+	username string
+	written  int64
+}
+
+func (w *quotaCountingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// NewDownloadQuotaMiddleware enforces config.Cfg.Quota.MonthlyDownloadBytes
+// per authenticated user, rejecting the request before any bytes are sent
+// if the quota is already exhausted, and charging the quota for the bytes
+// actually streamed once the handler completes.
+func NewDownloadQuotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := usernameFromContext(c)
+		if username == "" {
+			c.Next()
+			return
+		}
+		q, err := getDownloadQuota(username)
+		if err != nil {
+			log.Error().Err(err).Str("username", username).Msg("failed to read download quota")
+			c.Next()
+			return
+		}
+		limit := quotaLimitBytes()
+		if limit > 0 && q.BytesUsed >= limit {
+			c.Header("Retry-After", fmt.Sprintf("%d", secondsUntilNextMonth()))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "monthly download quota exceeded"})
+			return
+		}
+		cw := &quotaCountingWriter{ResponseWriter: c.Writer, username: username}
+		c.Writer = cw
+		c.Next()
+		q.BytesUsed += cw.written
+		if err := putDownloadQuota(username, q); err != nil {
+			log.Error().Err(err).Str("username", username).Msg("failed to persist download quota")
+		}
+	}
+}
+
+// QuotaInspectHandler is an admin endpoint returning a user's current
+// download quota usage.
+func QuotaInspectHandler(c *gin.Context) {
+	username := c.Param("username")
+	q, err := getDownloadQuota(username)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to read quota")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"username":     username,
+		"bytes_used":   q.BytesUsed,
+		"period_start": q.PeriodStart.Format(time.RFC3339),
+		"limit_bytes":  quotaLimitBytes(),
+	})
+}
+
+// QuotaResetHandler is an admin endpoint that zeroes a user's download
+// quota ahead of its natural monthly reset.
+func QuotaResetHandler(c *gin.Context) {
+	username := c.Param("username")
+	q := downloadQuota{PeriodStart: currentMonthStart()}
+	if err := putDownloadQuota(username, q); err != nil {
+		c.String(http.StatusInternalServerError, "failed to reset quota")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"username": username, "bytes_used": 0})
+}
+
+func secondsUntilNextMonth() int {
+	start := currentMonthStart()
+	next := time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return int(time.Until(next).Seconds())
+}
+
+// usernameFromContext returns the authenticated user set by
+// NewTokenMiddleware/NewBasicAuthMiddleware, or "" for anonymous/mirror
+// requests that have no quota to enforce.
+func usernameFromContext(c *gin.Context) string {
+	raw, ok := c.Get(UserKey)
+	if !ok {
+		return ""
+	}
+	user, ok := raw.(models.User)
+	if !ok {
+		return ""
+	}
+	return user.Username
+}
+
+func quotaLimitBytes() int64 {
+	return config.Cfg.Quota.MonthlyDownloadBytes
+}
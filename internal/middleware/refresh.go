@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gemfast/server/internal/db"
+	"github.com/gemfast/server/internal/models"
+
+	jmw "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// storedRefreshToken is what's persisted in db.REFRESH_TOKEN_BUCKET, keyed
+// by the sha256 hash of the opaque token handed to the client. The raw
+// token is never stored, only its hash, so a leaked BoltDB file can't be
+// replayed directly.
+type storedRefreshToken struct {
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IssueRefreshToken mints a new opaque refresh token for username and
+// persists its hash in BoltDB.
+func IssueRefreshToken(username string) (string, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	rt := storedRefreshToken{Username: username, ExpiresAt: time.Now().Add(refreshTokenTTL)}
+	rtBytes, err := json.Marshal(rt)
+	if err != nil {
+		return "", err
+	}
+	err = db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(db.REFRESH_TOKEN_BUCKET)).Put([]byte(hashToken(token)), rtBytes)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to persist refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// verifyRefreshToken looks up a presented refresh token and returns the
+// stored record if it exists, is unrevoked, and unexpired.
+func verifyRefreshToken(token string) (string, storedRefreshToken, error) {
+	hash := hashToken(token)
+	var rt storedRefreshToken
+	err := db.BoltDB.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket([]byte(db.REFRESH_TOKEN_BUCKET)).Get([]byte(hash))
+		if raw == nil {
+			return fmt.Errorf("refresh token not found")
+		}
+		return json.Unmarshal(raw, &rt)
+	})
+	if err != nil {
+		return hash, storedRefreshToken{}, err
+	}
+	if rt.Revoked {
+		return hash, rt, fmt.Errorf("refresh token has been revoked")
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		return hash, rt, fmt.Errorf("refresh token has expired")
+	}
+	return hash, rt, nil
+}
+
+func revokeRefreshTokenHash(hash string) error {
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.REFRESH_TOKEN_BUCKET))
+		raw := b.Get([]byte(hash))
+		if raw == nil {
+			return nil
+		}
+		var rt storedRefreshToken
+		if err := json.Unmarshal(raw, &rt); err != nil {
+			return err
+		}
+		rt.Revoked = true
+		rtBytes, err := json.Marshal(rt)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(hash), rtBytes)
+	})
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshHandler verifies a presented refresh token, rotates it (the
+// previous token is revoked and a new one issued), and returns a fresh
+// short-lived access JWT.
+func RefreshHandler(jwtMiddleware *jmw.GinJWTMiddleware) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req refreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.String(http.StatusBadRequest, "missing refresh_token")
+			return
+		}
+		hash, rt, err := verifyRefreshToken(req.RefreshToken)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to verify refresh token")
+			c.String(http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+		if err := revokeRefreshTokenHash(hash); err != nil {
+			log.Error().Err(err).Msg("failed to revoke rotated refresh token")
+		}
+		newRefreshToken, err := IssueRefreshToken(rt.Username)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to issue rotated refresh token")
+			c.String(http.StatusInternalServerError, "failed to rotate refresh token")
+			return
+		}
+		user, err := models.GetUser(rt.Username)
+		if err != nil || user.Username == "" {
+			c.String(http.StatusUnauthorized, "user no longer exists")
+			return
+		}
+		tokenString, expire, err := jwtMiddleware.TokenGenerator(user)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to generate access token")
+			c.String(http.StatusInternalServerError, "failed to generate access token")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token":         tokenString,
+			"expire":        expire.Format(time.RFC3339),
+			"refresh_token": newRefreshToken,
+		})
+	}
+}
+
+// LogoutHandler revokes the presented refresh token so it can no longer be
+// used to mint access tokens, giving sessions an actual server-side kill
+// switch.
+func LogoutHandler(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "missing refresh_token")
+		return
+	}
+	hash, _, err := verifyRefreshToken(req.RefreshToken)
+	if err != nil {
+		c.String(http.StatusOK, "logged out")
+		return
+	}
+	if err := revokeRefreshTokenHash(hash); err != nil {
+		log.Error().Err(err).Msg("failed to revoke refresh token")
+		c.String(http.StatusInternalServerError, "failed to log out")
+		return
+	}
+	c.String(http.StatusOK, "logged out")
+}
+
+// RevokeUserTokensHandler is an admin endpoint that revokes every
+// outstanding refresh token belonging to :username.
+func RevokeUserTokensHandler(c *gin.Context) {
+	username := c.Param("username")
+	revoked := 0
+	err := db.BoltDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.REFRESH_TOKEN_BUCKET))
+		// Collect the matching keys first; mutating b while b.ForEach is
+		// iterating over it is documented as undefined behavior and can
+		// skip or repeat entries, which would let some of username's
+		// tokens survive a "revoke all" call.
+		var toRevoke [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			var rt storedRefreshToken
+			if err := json.Unmarshal(v, &rt); err != nil {
+				return err
+			}
+			if rt.Username == username && !rt.Revoked {
+				toRevoke = append(toRevoke, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range toRevoke {
+			var rt storedRefreshToken
+			if err := json.Unmarshal(b.Get(k), &rt); err != nil {
+				return err
+			}
+			rt.Revoked = true
+			rtBytes, err := json.Marshal(rt)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(k, rtBytes); err != nil {
+				return err
+			}
+			revoked++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to revoke user refresh tokens")
+		c.String(http.StatusInternalServerError, "failed to revoke tokens")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"username": username, "revoked": revoked})
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gemfast/server/internal/auth"
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authChain is built once by InitAuthChain at router-init time, from
+// config.Env.AuthProviders, and used by LoginHandler for every request
+// after that.
+var authChain *auth.ChainProvider
+
+// InitAuthChain builds the auth provider chain LoginHandler authenticates
+// against. Must be called once during router initialization, alongside
+// initRateLimiters, before any request reaches LoginHandler.
+func InitAuthChain() error {
+	chain, err := auth.NewChainProviderFromConfig()
+	if err != nil {
+		return err
+	}
+	authChain = chain
+	return nil
+}
+
+type registerRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email"`
+}
+
+// RegisterHandler creates a new local user when self-service registration
+// is enabled via GEMFAST_ALLOW_REGISTRATION. Disabled by default, since
+// most deployments want users provisioned by an admin or by an upstream
+// auth backend (GitHub/OIDC) instead.
+func RegisterHandler(c *gin.Context) {
+	if !config.Env.AllowRegistration {
+		c.String(http.StatusForbidden, "self-service registration is disabled")
+		return
+	}
+	var req registerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "username and password are required")
+		return
+	}
+	existing, err := models.GetUser(req.Username)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to look up user during registration")
+		c.String(http.StatusInternalServerError, "failed to register user")
+		return
+	}
+	if existing.Username != "" {
+		c.String(http.StatusConflict, "username %s is already taken", req.Username)
+		return
+	}
+	if err := models.CreateLocalUser(req.Username, req.Password, req.Email); err != nil {
+		log.Error().Err(err).Msg("failed to create user")
+		c.String(http.StatusInternalServerError, "failed to register user")
+		return
+	}
+	c.String(http.StatusOK, "registered")
+}
+
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginHandler authenticates against authChain (local, LDAP, and/or OIDC,
+// in the order configured by config.Env.AuthProviders) and mints a push
+// token, the JSON-API equivalent of GemSigninHandler's Basic
+// Auth-based `gem signin`.
+func LoginHandler(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "username and password are required")
+		return
+	}
+	user, err := authChain.Authenticate(context.Background(), auth.Credentials{Username: req.Username, Password: req.Password})
+	if err != nil {
+		c.String(http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+	token, err := models.CreateUserToken(&user)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create token during login")
+		c.String(http.StatusInternalServerError, "failed to log in")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePasswordHandler lets the caller authenticated by NewBasicAuthMiddleware
+// rotate their own password, re-hashing with bcrypt and clearing their
+// legacy opaque token so that token stops working. Signed tokens issued
+// before the change are not revoked.
+func ChangePasswordHandler(c *gin.Context) {
+	raw, exists := c.Get(UserKey)
+	user, ok := raw.(models.User)
+	if !exists || !ok {
+		c.String(http.StatusUnauthorized, "no authenticated user")
+		return
+	}
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "current_password and new_password are required")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword(user.Password, []byte(req.CurrentPassword)); err != nil {
+		c.String(http.StatusUnauthorized, "current password is incorrect")
+		return
+	}
+	if err := models.UpdateUserPassword(user.Username, req.NewPassword); err != nil {
+		log.Error().Err(err).Msg("failed to update password")
+		c.String(http.StatusInternalServerError, "failed to update password")
+		return
+	}
+	c.String(http.StatusOK, "password updated")
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gemfast/server/internal/auth/scope"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// maxSelfServiceTokenTTL caps how long-lived a token a user can mint for
+// themselves via IssueTokenHandler. Longer-lived credentials still go
+// through the admin-gated POST /token endpoint.
+const maxSelfServiceTokenTTL = 30 * 24 * time.Hour
+
+type issueTokenRequest struct {
+	TTLSeconds int             `json:"ttl_seconds"`
+	Scope      json.RawMessage `json:"scope"`
+}
+
+type issueTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IssueTokenHandler lets an already-authenticated user mint a new,
+// optionally narrower-scoped, short-lived token for themselves — e.g. a
+// CI system exchanging a long-lived credential for a push token scoped
+// to a single gem before a release job.
+func IssueTokenHandler(c *gin.Context) {
+	raw, exists := c.Get(UserKey)
+	user, ok := raw.(models.User)
+	if !exists || !ok {
+		c.String(http.StatusUnauthorized, "no authenticated user")
+		return
+	}
+	var req issueTokenRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.String(http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	ttl := models.DefaultTokenTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > maxSelfServiceTokenTTL {
+		ttl = maxSelfServiceTokenTTL
+	}
+	tokenScope := user.Scope
+	if len(req.Scope) > 0 {
+		if _, err := scope.Parse(req.Scope); err != nil {
+			c.String(http.StatusBadRequest, "invalid scope: %v", err)
+			return
+		}
+		tokenScope = string(req.Scope)
+	}
+	token, err := models.IssueToken(user.Username, ttl, tokenScope)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to issue token")
+		c.String(http.StatusInternalServerError, "failed to issue token")
+		return
+	}
+	c.JSON(http.StatusOK, issueTokenResponse{Token: token, ExpiresAt: time.Now().Add(ttl)})
+}
+
+type tokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RefreshTokenHandler exchanges a token for a new one with the same
+// subject and scope, revoking the presented token's jti so it can't be
+// replayed once the caller has rotated off of it.
+func RefreshTokenHandler(c *gin.Context) {
+	var req tokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "missing token")
+		return
+	}
+	verified, err := models.VerifyToken(req.Token)
+	if err != nil {
+		c.String(http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
+	if err := models.RevokeToken(verified.JTI, verified.Expires); err != nil {
+		log.Error().Err(err).Msg("failed to revoke rotated token")
+	}
+	newToken, err := models.IssueToken(verified.Username, models.DefaultTokenTTL, verified.Scope)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to issue refreshed token")
+		c.String(http.StatusInternalServerError, "failed to refresh token")
+		return
+	}
+	c.JSON(http.StatusOK, issueTokenResponse{Token: newToken, ExpiresAt: time.Now().Add(models.DefaultTokenTTL)})
+}
+
+// RevokeTokenHandler blocks a single presented token's jti from passing
+// VerifyToken again, without affecting any other token issued to the
+// same user. Mirrors LogoutHandler's lenient behavior: an already
+// invalid/expired token is reported as revoked rather than erroring,
+// since the caller's goal (this token no longer works) is already true.
+func RevokeTokenHandler(c *gin.Context) {
+	var req tokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "missing token")
+		return
+	}
+	verified, err := models.VerifyToken(req.Token)
+	if err != nil {
+		c.String(http.StatusOK, "revoked")
+		return
+	}
+	if err := models.RevokeToken(verified.JTI, verified.Expires); err != nil {
+		log.Error().Err(err).Msg("failed to revoke token")
+		c.String(http.StatusInternalServerError, "failed to revoke token")
+		return
+	}
+	c.String(http.StatusOK, "revoked")
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gemfast/server/internal/auth/scope"
+	"github.com/gemfast/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const ScopeKey = "scope"
+const UserKey = "user"
+
+// createTokenRequest is the body accepted by the admin POST /token endpoint.
+// Scope is optional; when omitted the minted token inherits the target
+// user's role with no additional restriction.
+type createTokenRequest struct {
+	Username string          `json:"username" binding:"required"`
+	Scope    json.RawMessage `json:"scope"`
+}
+
+// NewTokenMiddleware authenticates requests bearing a previously minted
+// user token and attaches the authenticated user and parsed scope (if any)
+// to the gin context. Accepts either `Authorization: Bearer <jwt>` (the
+// current format, see models.IssueToken) or a bare legacy token during
+// the deprecation window; models.AuthenticateToken sorts out which.
+func NewTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			c.String(http.StatusUnauthorized, "missing authorization header")
+			c.Abort()
+			return
+		}
+		user, err := models.AuthenticateToken(token)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to authenticate token")
+			c.String(http.StatusUnauthorized, "invalid token")
+			c.Abort()
+			return
+		}
+		c.Set(UserKey, user)
+		if user.Scope != "" {
+			s, err := scope.Parse([]byte(user.Scope))
+			if err != nil {
+				log.Error().Err(err).Msg("failed to parse token scope")
+				c.String(http.StatusForbidden, "invalid token scope")
+				c.Abort()
+				return
+			}
+			c.Set(ScopeKey, s)
+		}
+	}
+}
+
+// CreateTokenHandler is the admin POST /token handler. It mints a token for
+// the named user, optionally bearing the scope described in the request
+// body, e.g. {"username":"ci","scope":{"type":"gem","names":["mylib-*"],"actions":["read","push"]}}.
+func CreateTokenHandler(c *gin.Context) {
+	var req createTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "invalid request body")
+		return
+	}
+	user, err := models.GetUser(req.Username)
+	if err != nil || user.Username == "" {
+		c.String(http.StatusNotFound, "user %s not found", req.Username)
+		return
+	}
+	if len(req.Scope) > 0 {
+		if _, err := scope.Parse(req.Scope); err != nil {
+			c.String(http.StatusBadRequest, "invalid scope: %v", err)
+			return
+		}
+		user.Scope = string(req.Scope)
+	}
+	token, err := models.CreateUserToken(&user)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create user token")
+		c.String(http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// AuthorizeScope checks the scope (if any) attached to the request context
+// against the given gem name and action, after the normal role-based ACL
+// check has already passed. A request with no scope attached (an
+// unscoped, role-only token) is always allowed through here.
+func AuthorizeScope(c *gin.Context, gemName string, action string) bool {
+	raw, exists := c.Get(ScopeKey)
+	if !exists {
+		return true
+	}
+	s, ok := raw.(scope.Scope)
+	if !ok {
+		return false
+	}
+	return s.Allows(gemName, action)
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gemfast/server/internal/db"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Permission is the access level granted to a user for gems matching a
+// pattern.
+type Permission string
+
+const (
+	ReadWrite Permission = "read-write"
+	ReadOnly  Permission = "read-only"
+	WriteOnly Permission = "write-only"
+	Deny      Permission = "deny"
+)
+
+// defaultPattern is the pattern stored for a user's fallback rule, applied
+// when no more specific pattern matches.
+const defaultPattern = "*"
+
+// ACLEntry is one per-user, per-gem-pattern rule, persisted in
+// db.ACL_BUCKET keyed by "username\x00gemPattern".
+type ACLEntry struct {
+	Username   string     `json:"username"`
+	Pattern    string     `json:"pattern"`
+	Permission Permission `json:"permission"`
+}
+
+func aclKey(username, pattern string) []byte {
+	return []byte(username + "\x00" + pattern)
+}
+
+// PutACLEntry creates or replaces the rule for (username, pattern).
+func PutACLEntry(e ACLEntry) error {
+	if e.Permission != ReadWrite && e.Permission != ReadOnly && e.Permission != WriteOnly && e.Permission != Deny {
+		return fmt.Errorf("invalid permission %q", e.Permission)
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(db.ACL_BUCKET)).Put(aclKey(e.Username, e.Pattern), raw)
+	})
+}
+
+// DeleteACLEntry removes the rule for (username, pattern), if any.
+func DeleteACLEntry(username, pattern string) error {
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(db.ACL_BUCKET)).Delete(aclKey(username, pattern))
+	})
+}
+
+// GetACLEntries returns every rule configured for username, in no
+// particular order; use MatchACL to resolve which one applies to a gem.
+func GetACLEntries(username string) ([]ACLEntry, error) {
+	var entries []ACLEntry
+	prefix := []byte(username + "\x00")
+	err := db.BoltDB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(db.ACL_BUCKET)).Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var e ACLEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// specificity ranks patterns so the most specific match wins: an exact
+// (non-glob) pattern beats a glob, and among globs a longer literal
+// prefix before the first "*" beats a shorter one. The bare "*" default
+// pattern always ranks lowest.
+func specificity(pattern string) int {
+	if pattern == defaultPattern {
+		return -1
+	}
+	if idx := strings.IndexByte(pattern, '*'); idx >= 0 {
+		return idx
+	}
+	return len(pattern) + 1 // exact match beats any glob prefix of the same length
+}
+
+// MatchACL resolves which permission applies to gemName for username,
+// given every rule PutACLEntry has stored for them. Rules are evaluated
+// most-specific-first; an explicit "deny" always wins over a same-or-less
+// specific wildcard grant, matching the order ties are broken below.
+// defaultPermission is returned when no rule (including no default "*"
+// rule) matches at all.
+func MatchACL(entries []ACLEntry, gemName string, defaultPermission Permission) Permission {
+	sorted := make([]ACLEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		si, sj := specificity(sorted[i].Pattern), specificity(sorted[j].Pattern)
+		if si != sj {
+			return si > sj
+		}
+		// Equal specificity: deny wins the tie.
+		return sorted[i].Permission == Deny && sorted[j].Permission != Deny
+	})
+	for _, e := range sorted {
+		if e.Pattern == defaultPattern {
+			continue
+		}
+		if ok, err := filepath.Match(e.Pattern, gemName); err == nil && ok {
+			return e.Permission
+		}
+	}
+	for _, e := range sorted {
+		if e.Pattern == defaultPattern {
+			return e.Permission
+		}
+	}
+	return defaultPermission
+}
+
+// CanRead and CanWrite are the two checks every enforcement point needs;
+// write-only/read-only/deny/read-write all resolve unambiguously through
+// them.
+func CanRead(p Permission) bool {
+	return p == ReadWrite || p == ReadOnly
+}
+
+func CanWrite(p Permission) bool {
+	return p == ReadWrite || p == WriteOnly
+}
+
+// AuthorizeGem loads username's ACL entries and resolves the permission
+// for gemName in one call, logging lookup failures rather than silently
+// defaulting to deny, so an admin notices a BoltDB problem instead of
+// mysteriously losing access.
+func AuthorizeGem(username, gemName string, defaultPermission Permission) Permission {
+	entries, err := GetACLEntries(username)
+	if err != nil {
+		log.Error().Err(err).Str("username", username).Msg("failed to load ACL entries")
+		return defaultPermission
+	}
+	return MatchACL(entries, gemName, defaultPermission)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/gemfast/server/internal/db"
+	"github.com/gemfast/server/internal/db/index"
 	bolt "go.etcd.io/bbolt"
 )
 
@@ -13,6 +14,22 @@ type Gem struct {
 	Name     string `json:"name"`
 	Number   string `json:"number"`
 	Platform string `json:"platform"`
+	// Dependencies, Checksum, RequiredRubyVersion, and
+	// RequiredRubygemsVersion are populated from the gem's own gemspec at
+	// upload time (see compactindex.AppendVersion) so the compact index
+	// /info line built from this Gem carries the fields Bundler's
+	// resolver actually needs, not just a bare version number.
+	Dependencies            []GemDependency `json:"dependencies,omitempty"`
+	Checksum                string          `json:"checksum,omitempty"`
+	RequiredRubyVersion     string          `json:"required_ruby_version,omitempty"`
+	RequiredRubygemsVersion string          `json:"required_rubygems_version,omitempty"`
+}
+
+// GemDependency is one runtime dependency of a Gem version, as declared
+// in its gemspec.
+type GemDependency struct {
+	Name        string `json:"name"`
+	Requirement string `json:"requirement"`
 }
 
 func GemFromGemParameter(param string) *Gem {
@@ -42,6 +59,36 @@ func GemFromBytes(data []byte) (*[]Gem, error) {
 	return p, nil
 }
 
+// PutGem records a newly indexed gem version under db.GEM_DEPENDENCY_BUCKET,
+// replacing any existing entry for the same (Name, Number, Platform) so a
+// re-upload updates its stored metadata instead of appending a duplicate.
+func PutGem(gem Gem) error {
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.GEM_DEPENDENCY_BUCKET))
+		existing, _ := GemFromBytes(b.Get([]byte(gem.Name)))
+		var versions []Gem
+		if existing != nil {
+			versions = *existing
+		}
+		replaced := false
+		for i, g := range versions {
+			if g.Number == gem.Number && g.Platform == gem.Platform {
+				versions[i] = gem
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			versions = append(versions, gem)
+		}
+		raw, err := json.Marshal(versions)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(gem.Name), raw)
+	})
+}
+
 func GetGem(name string) ([]Gem, error) {
 	var gems []Gem
 	err := db.BoltDB.View(func(tx *bolt.Tx) error {
@@ -57,6 +104,126 @@ func GetGem(name string) ([]Gem, error) {
 
 }
 
+// GemMetadata is the ownership/namespace record for a gem name, stored in
+// db.GEM_METADATA_BUCKET and kept queryable by owner and by namespace via
+// db.GEM_BY_OWNER_IDX / db.GEM_BY_NAMESPACE_IDX.
+type GemMetadata struct {
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	Namespace string `json:"namespace"`
+}
+
+// PutGemMetadata records (or updates) the owner/namespace for a gem name,
+// maintaining both secondary indexes in the same transaction.
+func PutGemMetadata(m GemMetadata) error {
+	previous, err := getGemMetadata(m.Name)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(db.GEM_METADATA_BUCKET)).Put([]byte(m.Name), raw); err != nil {
+			return err
+		}
+		if previous.Owner != "" && previous.Owner != m.Owner {
+			if err := index.Delete(tx, db.GEM_BY_OWNER_IDX, previous.Owner, m.Name); err != nil {
+				return err
+			}
+		}
+		if previous.Namespace != "" && previous.Namespace != m.Namespace {
+			if err := index.Delete(tx, db.GEM_BY_NAMESPACE_IDX, previous.Namespace, m.Name); err != nil {
+				return err
+			}
+		}
+		if m.Owner != "" {
+			if err := index.Put(tx, db.GEM_BY_OWNER_IDX, m.Owner, m.Name); err != nil {
+				return err
+			}
+		}
+		if m.Namespace != "" {
+			return index.Put(tx, db.GEM_BY_NAMESPACE_IDX, m.Namespace, m.Name)
+		}
+		return nil
+	})
+}
+
+// DeleteGemMetadata removes a gem name's ownership record and both of its
+// index entries, e.g. once the last version of that gem has been yanked.
+func DeleteGemMetadata(name string) error {
+	previous, err := getGemMetadata(name)
+	if err != nil {
+		return err
+	}
+	if previous.Name == "" {
+		return nil
+	}
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(db.GEM_METADATA_BUCKET)).Delete([]byte(name)); err != nil {
+			return err
+		}
+		if previous.Owner != "" {
+			if err := index.Delete(tx, db.GEM_BY_OWNER_IDX, previous.Owner, name); err != nil {
+				return err
+			}
+		}
+		if previous.Namespace != "" {
+			return index.Delete(tx, db.GEM_BY_NAMESPACE_IDX, previous.Namespace, name)
+		}
+		return nil
+	})
+}
+
+// GetGemMetadata returns the ownership/namespace record for name, or a
+// zero-value GemMetadata if none has been recorded yet.
+func GetGemMetadata(name string) (GemMetadata, error) {
+	return getGemMetadata(name)
+}
+
+func getGemMetadata(name string) (GemMetadata, error) {
+	var m GemMetadata
+	err := db.BoltDB.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket([]byte(db.GEM_METADATA_BUCKET)).Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &m)
+	})
+	return m, err
+}
+
+// GetGemsByOwner resolves every gem owned by owner via db.GEM_BY_OWNER_IDX,
+// a single Cursor().Seek rather than a full GEM_METADATA_BUCKET scan.
+func GetGemsByOwner(owner string) ([]GemMetadata, error) {
+	return gemMetadataByIndex(db.GEM_BY_OWNER_IDX, owner)
+}
+
+// GetGemsByNamespace resolves every gem in namespace via
+// db.GEM_BY_NAMESPACE_IDX.
+func GetGemsByNamespace(namespace string) ([]GemMetadata, error) {
+	return gemMetadataByIndex(db.GEM_BY_NAMESPACE_IDX, namespace)
+}
+
+func gemMetadataByIndex(indexBucket, attribute string) ([]GemMetadata, error) {
+	names, err := index.SeekExact(indexBucket, attribute)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make([]GemMetadata, 0, len(names))
+	for _, name := range names {
+		m, err := getGemMetadata(name)
+		if err != nil {
+			return nil, err
+		}
+		if m.Name != "" {
+			metadata = append(metadata, m)
+		}
+	}
+	return metadata, nil
+}
+
 func GetGems() ([][]Gem, error) {
 	var gems [][]Gem
 	err := db.BoltDB.View(func(tx *bolt.Tx) error {
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/gemfast/server/internal/db"
+	"github.com/gemfast/server/internal/db/index"
+)
+
+// ReconcileIndexes rebuilds every secondary index from its primary bucket.
+// Called once at startup (see cmd/gemfast-server/start.go) so an index
+// bucket that's missing entirely (fresh deploy of this feature against an
+// existing BoltDB file) or that's drifted from its primary bucket (bug,
+// restore from an older backup) self-heals without manual intervention.
+func ReconcileIndexes() error {
+	if err := index.Rebuild(db.USER_BUCKET, db.USER_BY_EMAIL_IDX, func(_ string, value []byte) []string {
+		user, err := userFromBytes(value)
+		if err != nil || user.Email == "" {
+			return nil
+		}
+		return []string{user.Email}
+	}); err != nil {
+		return err
+	}
+	if err := index.Rebuild(db.GEM_METADATA_BUCKET, db.GEM_BY_OWNER_IDX, func(_ string, value []byte) []string {
+		var m GemMetadata
+		if err := json.Unmarshal(value, &m); err != nil || m.Owner == "" {
+			return nil
+		}
+		return []string{m.Owner}
+	}); err != nil {
+		return err
+	}
+	return index.Rebuild(db.GEM_METADATA_BUCKET, db.GEM_BY_NAMESPACE_IDX, func(_ string, value []byte) []string {
+		var m GemMetadata
+		if err := json.Unmarshal(value, &m); err != nil || m.Namespace == "" {
+			return nil
+		}
+		return []string{m.Namespace}
+	})
+}
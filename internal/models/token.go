@@ -0,0 +1,208 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gemfast/server/internal/db"
+
+	"github.com/golang-jwt/jwt/v4"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultTokenTTL is used by CreateUserToken; callers minting their own
+// token via IssueToken (see middleware's self-service /api/v1/token
+// routes) can pick a shorter one.
+const DefaultTokenTTL = 90 * 24 * time.Hour
+
+// tokenClaims is what gets signed into a push token. Scope mirrors
+// User.Scope (the JSON-encoded spec from internal/auth/scope) so
+// VerifyToken callers can reconstruct it without a second BoltDB lookup.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Scope string `json:"scope,omitempty"`
+}
+
+// VerifiedToken is what VerifyToken hands back: enough to populate the
+// request context without a redundant GetUser call for the common case.
+type VerifiedToken struct {
+	Username string
+	Scope    string
+	JTI      string
+	Expires  time.Time
+}
+
+const signingKeyBoltKey = "jwt_signing_key"
+
+var signingKey []byte
+
+// signingSecret loads the HS256 key from db.CONFIG_BUCKET, generating and
+// persisting a new random one on first boot so every gemfast node that
+// shares the same BoltDB file (or, in cluster mode, the same shared
+// metadata store) verifies tokens minted by any of them.
+func signingSecret() ([]byte, error) {
+	if signingKey != nil {
+		return signingKey, nil
+	}
+	var key []byte
+	err := db.BoltDB.View(func(tx *bolt.Tx) error {
+		key = tx.Bucket([]byte(db.CONFIG_BUCKET)).Get([]byte(signingKeyBoltKey))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate jwt signing key: %w", err)
+		}
+		key = []byte(hex.EncodeToString(raw))
+		err = db.BoltDB.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(db.CONFIG_BUCKET)).Put([]byte(signingKeyBoltKey), key)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to persist jwt signing key: %w", err)
+		}
+	}
+	signingKey = key
+	return signingKey, nil
+}
+
+func generateJTI() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// IssueToken mints a signed push token for username, valid for ttl, with
+// scope carried as a claim (e.g. "read", "write", "admin", or a
+// JSON-encoded internal/auth/scope spec).
+func IssueToken(username string, ttl time.Duration, scope string) (string, error) {
+	key, err := signingSecret()
+	if err != nil {
+		return "", err
+	}
+	jti, err := generateJTI()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	now := time.Now()
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Scope: scope,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(key)
+}
+
+// VerifyToken validates signature and expiry and rejects a token whose
+// jti has been revoked. It does not itself check that the user named by
+// the token still exists — callers needing the full User record should
+// follow up with GetUser(result.Username).
+func VerifyToken(tokenStr string) (VerifiedToken, error) {
+	key, err := signingSecret()
+	if err != nil {
+		return VerifiedToken{}, err
+	}
+	var claims tokenClaims
+	parsed, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil || !parsed.Valid {
+		return VerifiedToken{}, fmt.Errorf("invalid token: %w", err)
+	}
+	revoked, err := isTokenRevoked(claims.ID)
+	if err != nil {
+		return VerifiedToken{}, err
+	}
+	if revoked {
+		return VerifiedToken{}, fmt.Errorf("token has been revoked")
+	}
+	return VerifiedToken{
+		Username: claims.Subject,
+		Scope:    claims.Scope,
+		JTI:      claims.ID,
+		Expires:  claims.ExpiresAt.Time,
+	}, nil
+}
+
+// revokedTokenRecord is stored in db.REVOKED_TOKENS_BUCKET, keyed by jti, so
+// isTokenRevoked can purge an entry, the next time it looks it up, once the
+// token it refers to would have expired naturally anyway.
+type revokedTokenRecord struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RevokeToken blocks a token's jti from passing VerifyToken again, even
+// though its signature and expiry are still otherwise valid. expires
+// should be the token's own exp claim, so the revocation record can be
+// garbage-collected once it would have expired anyway.
+func RevokeToken(jti string, expires time.Time) error {
+	raw, err := json.Marshal(revokedTokenRecord{ExpiresAt: expires})
+	if err != nil {
+		return err
+	}
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(db.REVOKED_TOKENS_BUCKET)).Put([]byte(jti), raw)
+	})
+}
+
+// AuthenticateToken resolves a presented API token to the user it belongs
+// to, trying it as a signed JWT first and falling back to the legacy
+// opaque/encrypted token format (see GetUserByToken) during the
+// deprecation window for tokens minted before IssueToken existed.
+func AuthenticateToken(token string) (User, error) {
+	if verified, err := VerifyToken(token); err == nil {
+		user, err := GetUser(verified.Username)
+		if err != nil {
+			return User{}, err
+		}
+		if user.Username == "" {
+			return User{}, fmt.Errorf("no user found matching token subject %q", verified.Username)
+		}
+		// The token's scope is carried as a claim, not persisted on the
+		// user record (see CreateUserToken), so it must be copied onto
+		// the returned User here or NewTokenMiddleware/NewBasicAuthMiddleware
+		// see an empty user.Scope and treat every scoped token as unscoped.
+		user.Scope = verified.Scope
+		return user, nil
+	}
+	return GetUserByToken(token)
+}
+
+func isTokenRevoked(jti string) (bool, error) {
+	var found bool
+	err := db.BoltDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(db.REVOKED_TOKENS_BUCKET))
+		raw := b.Get([]byte(jti))
+		if raw == nil {
+			return nil
+		}
+		var rec revokedTokenRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return err
+		}
+		if time.Now().After(rec.ExpiresAt) {
+			// The underlying token would be rejected as expired anyway;
+			// drop the now-pointless revocation record.
+			return b.Delete([]byte(jti))
+		}
+		found = true
+		return nil
+	})
+	return found, err
+}
@@ -1,13 +1,14 @@
 package models
 
 import (
-	b64 "encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/crypto"
 	"github.com/gemfast/server/internal/db"
+	"github.com/gemfast/server/internal/db/index"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sethvargo/go-password/password"
@@ -19,6 +20,33 @@ type User struct {
 	Username string
 	Password []byte
 	Token    string
+	// Scope holds the JSON-encoded scope spec (see internal/auth/scope) of
+	// the token a request authenticated with, restricting it to specific
+	// gems/actions. It is carried as a token claim and copied here by
+	// AuthenticateToken, not persisted with the user record. Empty for
+	// unscoped tokens.
+	Scope string
+	// OIDCRefreshToken is persisted for users authenticated via the
+	// generic OIDC backend so the access token can be silently refreshed
+	// without bouncing the user through the browser again.
+	OIDCRefreshToken string
+	// Email is optional and, when set, is kept in sync with
+	// db.USER_BY_EMAIL_IDX so GetUsersByEmailPrefix can resolve it
+	// without a full USER_BUCKET scan.
+	Email string
+	// Provider names the internal/auth.AuthProvider that vouched for this
+	// user: "" (the zero value) for a locally-created account, or an
+	// external provider's Name() for a shadow user created on first
+	// federated login (see CreateShadowUser). Shadow users have no
+	// Password, so AuthenticateLocalUser always rejects them — they must
+	// keep authenticating through the provider that created them.
+	Provider string
+	// Role is the ACL role this user authenticates with (see
+	// middleware.ACL.Enforce). CreateLocalUser, CreateLocalUsers and
+	// CreateAdminUserIfNotExists leave it empty; federated users get it
+	// from their provider's group/role mapping (e.g. OIDCMiddleware's
+	// OIDCGroupRoles) via SetUserRole.
+	Role string
 }
 
 func userFromBytes(data []byte) (*User, error) {
@@ -59,6 +87,29 @@ func GetUser(username string) (User, error) {
 	return *user, nil
 }
 
+func GetUserByToken(token string) (User, error) {
+	users, err := GetUsers()
+	if err != nil {
+		return User{}, err
+	}
+	for _, u := range users {
+		if u.Token == "" {
+			continue
+		}
+		stored, err := crypto.Decrypt(u.Token)
+		if err != nil {
+			// Pre-encryption records stored the raw token directly; fall
+			// back to a plain comparison so existing tokens keep working
+			// until the user re-mints one.
+			stored = u.Token
+		}
+		if stored == token {
+			return u, nil
+		}
+	}
+	return User{}, fmt.Errorf("no user found with the provided token")
+}
+
 func GetUsers() ([]User, error) {
 	var users []User
 	err := db.BoltDB.View(func(tx *bolt.Tx) error {
@@ -79,6 +130,50 @@ func GetUsers() ([]User, error) {
 	return users, nil
 }
 
+// GetUsersByEmailPrefix resolves every user whose email begins with
+// prefix via db.USER_BY_EMAIL_IDX, a single Cursor().Seek rather than the
+// full-bucket walk GetUsers does.
+func GetUsersByEmailPrefix(prefix string) ([]User, error) {
+	usernames, err := index.SeekPrefix(db.USER_BY_EMAIL_IDX, prefix)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]User, 0, len(usernames))
+	for _, username := range usernames {
+		user, err := GetUser(username)
+		if err != nil {
+			return nil, err
+		}
+		if user.Username != "" {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// putUserIndexed writes user to USER_BUCKET and keeps USER_BY_EMAIL_IDX in
+// sync within the same transaction. oldEmail is the email the user was
+// previously indexed under, if any, so a changed (or cleared) email
+// doesn't leave a stale index entry behind; pass "" for a brand new user.
+func putUserIndexed(tx *bolt.Tx, user User, oldEmail string) error {
+	userBytes, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("could not marshal user to json: %v", err)
+	}
+	if err := tx.Bucket([]byte(db.USER_BUCKET)).Put([]byte(user.Username), userBytes); err != nil {
+		return fmt.Errorf("could not set: %v", err)
+	}
+	if oldEmail != "" && oldEmail != user.Email {
+		if err := index.Delete(tx, db.USER_BY_EMAIL_IDX, oldEmail, user.Username); err != nil {
+			return err
+		}
+	}
+	if user.Email != "" {
+		return index.Put(tx, db.USER_BY_EMAIL_IDX, user.Email, user.Username)
+	}
+	return nil
+}
+
 func CreateAdminUserIfNotExists() error {
 	user, err := GetUser("admin")
 	if err != nil {
@@ -99,18 +194,9 @@ func CreateAdminUserIfNotExists() error {
 		Username: "admin",
 		Password: getAdminPassword(),
 	}
-	userBytes, err := json.Marshal(user)
-	if err != nil {
-		return fmt.Errorf("could not marshal user to json: %v", err)
-	}
-	err = db.BoltDB.Update(func(tx *bolt.Tx) error {
-		err = tx.Bucket([]byte(db.USER_BUCKET)).Put([]byte(user.Username), userBytes)
-		if err != nil {
-			return fmt.Errorf("could not set: %v", err)
-		}
-		return nil
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return putUserIndexed(tx, user, "")
 	})
-	return nil
 }
 
 func CreateLocalUsers() error {
@@ -137,7 +223,6 @@ func CreateLocalUsers() error {
 	usersFromEnv := config.Env.AddLocalUsers
 	pairs := strings.Split(usersFromEnv, ",")
 	db.BoltDB.Batch(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(db.USER_BUCKET))
 		for _, pair := range pairs {
 			u := strings.Split(pair, ":")
 			username := u[0]
@@ -151,17 +236,28 @@ func CreateLocalUsers() error {
 				Password: pwbytes,
 			}
 			m[username] = true
-			userBytes, err := json.Marshal(userToAdd)
-			if err != nil {
-				return fmt.Errorf("could not marshal user to json: %v", err)
-			}
 			log.Trace().Str("username", username).Msg("added or modified user")
-			b.Put([]byte(username), userBytes)
+			oldEmail := ""
+			if existing := tx.Bucket([]byte(db.USER_BUCKET)).Get([]byte(username)); existing != nil {
+				if prev, err := userFromBytes(existing); err == nil {
+					oldEmail = prev.Email
+				}
+			}
+			if err := putUserIndexed(tx, userToAdd, oldEmail); err != nil {
+				return err
+			}
 		}
-		b = tx.Bucket([]byte(db.USER_BUCKET))
+		b := tx.Bucket([]byte(db.USER_BUCKET))
 		for _, username := range usernames {
 			if m[username] != true {
 				log.Trace().Str("username", username).Msg("removed user")
+				if existing := b.Get([]byte(username)); existing != nil {
+					if user, err := userFromBytes(existing); err == nil && user.Email != "" {
+						if err := index.Delete(tx, db.USER_BY_EMAIL_IDX, user.Email, username); err != nil {
+							return err
+						}
+					}
+				}
 				b.Delete([]byte(username))
 			}
 		}
@@ -170,6 +266,95 @@ func CreateLocalUsers() error {
 	return nil
 }
 
+// CreateLocalUser persists a brand new local user with a bcrypt-hashed
+// password, for self-service registration (see
+// internal/middleware.RegisterHandler). Callers must check GetUser first
+// to reject a duplicate username; this always overwrites. email may be
+// empty; when set it's kept queryable via GetUsersByEmailPrefix.
+func CreateLocalUser(username, plaintextPassword, email string) error {
+	pwbytes, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 14)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+	user := User{Username: username, Password: pwbytes, Email: email}
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return putUserIndexed(tx, user, "")
+	})
+}
+
+// CreateShadowUser persists a passwordless placeholder user for an
+// identity an external internal/auth.AuthProvider just vouched for, so
+// CreateUserToken and the ACL system have a normal User record to attach
+// a token/scope/ACL entries to. See internal/auth.EnsureShadowUser, which
+// is what actually calls this.
+func CreateShadowUser(username, providerName string) error {
+	user := User{Username: username, Provider: providerName}
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return putUserIndexed(tx, user, "")
+	})
+}
+
+// UpdateUserPassword re-hashes and persists a new password for username
+// and clears the user's legacy opaque token, so that token can no longer
+// be used to authenticate as them. Signed tokens already issued by
+// IssueToken are not revoked and stay valid until they expire.
+func UpdateUserPassword(username, plaintextPassword string) error {
+	user, err := GetUser(username)
+	if err != nil {
+		return err
+	}
+	if user.Username == "" {
+		return fmt.Errorf("no user found with username %s", username)
+	}
+	pwbytes, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 14)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+	user.Password = pwbytes
+	user.Token = ""
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return putUserIndexed(tx, user, user.Email)
+	})
+}
+
+// SetOIDCRefreshToken persists a silently-refreshed OIDC refresh token for
+// username, so the next request's refreshIfNeeded sees it instead of the
+// one that was just exchanged (see internal/middleware/oidc.go and
+// internal/auth/oidc.go, both of which authenticate the same federated
+// identity and must keep this field in sync).
+func SetOIDCRefreshToken(username, refreshToken string) error {
+	user, err := GetUser(username)
+	if err != nil {
+		return err
+	}
+	if user.Username == "" {
+		return fmt.Errorf("no user found with username %s", username)
+	}
+	user.OIDCRefreshToken = refreshToken
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return putUserIndexed(tx, user, user.Email)
+	})
+}
+
+// SetUserRole persists role for username, e.g. the group-mapped role an
+// OIDC login resolved on this request (see
+// OIDCMiddleware.userFromClaims), so ACL enforcement on later requests
+// sees the same role without needing to recompute it from the provider's
+// claims every time.
+func SetUserRole(username, role string) error {
+	user, err := GetUser(username)
+	if err != nil {
+		return err
+	}
+	if user.Username == "" {
+		return fmt.Errorf("no user found with username %s", username)
+	}
+	user.Role = role
+	return db.BoltDB.Update(func(tx *bolt.Tx) error {
+		return putUserIndexed(tx, user, user.Email)
+	})
+}
+
 func getAdminPassword() []byte {
 	var pw string
 	var err error
@@ -199,23 +384,19 @@ func generatePassword() (string, error) {
 	return pw, nil
 }
 
+// CreateUserToken mints a signed JWT, valid for DefaultTokenTTL, carrying
+// user's current scope as a claim. Unlike the opaque random token this
+// replaced, nothing needs to be persisted here: VerifyToken checks the
+// signature and exp claim directly, and AuthenticateToken still falls back
+// to the legacy encrypted-token comparison in GetUserByToken for tokens
+// minted before this change. A legacy token has no expiry; it keeps
+// working until it is cleared from the user record (UpdateUserPassword
+// does so).
 func CreateUserToken(user *User) (string, error) {
-	token, err := password.Generate(32, 10, 10, false, false)
+	token, err := IssueToken(user.Username, DefaultTokenTTL, user.Scope)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to generate a token")
+		log.Error().Err(err).Msg("failed to issue token")
 		return "", err
 	}
-	user.Token = token
-	userBytes, err := json.Marshal(user)
-	if err != nil {
-		return "", fmt.Errorf("could not marshal user to json: %v", err)
-	}
-	err = db.BoltDB.Update(func(tx *bolt.Tx) error {
-		err = tx.Bucket([]byte(db.USER_BUCKET)).Put([]byte(user.Username), userBytes)
-		if err != nil {
-			return fmt.Errorf("could not set: %v", err)
-		}
-		return nil
-	})
-	return b64.StdEncoding.EncodeToString([]byte(token)), err
+	return token, nil
 }
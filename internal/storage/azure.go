@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+
+	gemfastconfig "github.com/gemfast/server/internal/config"
+)
+
+// azureBackend stores objects as blobs in an Azure Storage container.
+type azureBackend struct {
+	client    *azblob.Client
+	container string
+}
+
+func newAzureBackend(cfg gemfastconfig.AzureStorageConfig) (*azureBackend, error) {
+	serviceURL := "https://" + cfg.Account + ".blob.core.windows.net/"
+	cred, err := azblob.NewSharedKeyCredential(cfg.Account, cfg.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+	client, err := azblob.NewClientWithSharedKeyCredential(serviceURL, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &azureBackend{client: client, container: cfg.Container}, nil
+}
+
+func (a *azureBackend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := a.client.ServiceClient().NewContainerClient(a.container).NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info := ObjectInfo{Key: key}
+	if resp.ContentLength != nil {
+		info.Size = *resp.ContentLength
+	}
+	if resp.ETag != nil {
+		info.ETag = string(*resp.ETag)
+	}
+	return info, nil
+}
+
+func (a *azureBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := a.client.DownloadStream(ctx, a.container, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (a *azureBackend) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := a.client.UploadStream(ctx, a.container, key, r, nil)
+	return err
+}
+
+func (a *azureBackend) Delete(ctx context.Context, key string) error {
+	_, err := a.client.DeleteBlob(ctx, a.container, key, nil)
+	return err
+}
+
+func (a *azureBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	pager := a.client.NewListBlobsFlatPager(a.container, &container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range page.Segment.BlobItems {
+			info := ObjectInfo{}
+			if blob.Name != nil {
+				info.Key = *blob.Name
+			}
+			if blob.Properties != nil && blob.Properties.ContentLength != nil {
+				info.Size = *blob.Properties.ContentLength
+			}
+			objects = append(objects, info)
+		}
+	}
+	return objects, nil
+}
+
+func (a *azureBackend) PresignGet(_ context.Context, key string, expiry time.Duration) (string, error) {
+	blobClient := a.client.ServiceClient().NewContainerClient(a.container).NewBlobClient(key)
+	sasURL, err := blobClient.GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(expiry), nil)
+	if err != nil {
+		return "", err
+	}
+	return sasURL, nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	gemfastconfig "github.com/gemfast/server/internal/config"
+)
+
+// gcsBackend stores objects in a Google Cloud Storage bucket.
+type gcsBackend struct {
+	client         *storage.Client
+	bucket         string
+	googleAccessID string
+	privateKey     []byte
+}
+
+func newGCSBackend(cfg gemfastconfig.GCSStorageConfig) (*gcsBackend, error) {
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	client, err := storage.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsBackend{
+		client:         client,
+		bucket:         cfg.Bucket,
+		googleAccessID: cfg.GoogleAccessID,
+		privateKey:     []byte(cfg.PrivateKey),
+	}, nil
+}
+
+func (g *gcsBackend) object(key string) *storage.ObjectHandle {
+	return g.client.Bucket(g.bucket).Object(key)
+}
+
+func (g *gcsBackend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	attrs, err := g.object(key).Attrs(ctx)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: attrs.Size, ETag: attrs.Etag}, nil
+}
+
+func (g *gcsBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return g.object(key).NewReader(ctx)
+}
+
+func (g *gcsBackend) Put(ctx context.Context, key string, r io.Reader) error {
+	w := g.object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (g *gcsBackend) Delete(ctx context.Context, key string) error {
+	return g.object(key).Delete(ctx)
+}
+
+func (g *gcsBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	it := g.client.Bucket(g.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, ObjectInfo{Key: attrs.Name, Size: attrs.Size, ETag: attrs.Etag})
+	}
+	return objects, nil
+}
+
+func (g *gcsBackend) PresignGet(_ context.Context, key string, expiry time.Duration) (string, error) {
+	return storage.SignedURL(g.bucket, key, &storage.SignedURLOptions{
+		GoogleAccessID: g.googleAccessID,
+		PrivateKey:     g.privateKey,
+		Method:         "GET",
+		Expires:        time.Now().Add(expiry),
+	})
+}
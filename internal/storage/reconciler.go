@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// reconcileKeys are the legacy index artifacts bundler clients fetch
+// directly; when a remote backend is configured these must also exist
+// on local disk so indexer.GenerateIndex's output stays servable even if
+// it was regenerated while pointed at the object store.
+var reconcileKeys = []string{
+	"specs.4.8.gz",
+	"latest_specs.4.8.gz",
+	"prerelease_specs.4.8.gz",
+}
+
+// StartReconciler periodically pulls reconcileKeys down from the
+// configured backend to local disk, keeping gemfast's on-disk indexer
+// output in sync with the remote copy. It's a no-op loop for the local
+// backend, since Get/Put already operate on the same files. Call it once
+// from cmd/gemfast-server after storage.Init.
+func StartReconciler(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reconcileOnce(ctx)
+			}
+		}
+	}()
+}
+
+func reconcileOnce(ctx context.Context) {
+	local := backend
+	if _, ok := local.(*localBackend); ok {
+		return
+	}
+	for _, key := range reconcileKeys {
+		remoteInfo, err := backend.Stat(ctx, key)
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("reconciler failed to stat remote index file")
+			continue
+		}
+		localPath := newLocalBackend(config.Env.Dir)
+		localInfo, err := localPath.Stat(ctx, key)
+		if err == nil && localInfo.Size == remoteInfo.Size {
+			continue
+		}
+		r, err := backend.Get(ctx, key)
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("reconciler failed to fetch remote index file")
+			continue
+		}
+		err = localPath.Put(ctx, key, r)
+		r.Close()
+		if err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("reconciler failed to write local index file")
+			continue
+		}
+		log.Info().Str("key", key).Msg("reconciler synced index file from remote storage backend")
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	gemfastconfig "github.com/gemfast/server/internal/config"
+)
+
+// s3Backend targets any S3-compatible object store (AWS S3, MinIO,
+// Cloudflare R2, ...). Endpoint/UsePathStyle exist so it can be pointed at
+// a MinIO deployment rather than assuming real AWS.
+type s3Backend struct {
+	client *s3.Client
+	bucket string
+}
+
+func newS3Backend(cfg gemfastconfig.S3StorageConfig) (*s3Backend, error) {
+	var optFns []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		optFns = append(optFns, awsconfig.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKeyID != "" && cfg.SecretAccessKey != "" {
+		optFns = append(optFns, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), optFns...)
+	if err != nil {
+		return nil, err
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+	return &s3Backend{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *s3Backend) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info := ObjectInfo{Key: key}
+	if out.ContentLength != nil {
+		info.Size = *out.ContentLength
+	}
+	if out.ETag != nil {
+		info.ETag = *out.ETag
+	}
+	return info, nil
+}
+
+func (s *s3Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *s3Backend) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key), Body: r})
+	return err
+}
+
+func (s *s3Backend) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	return err
+}
+
+func (s *s3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	out, err := s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket), Prefix: aws.String(prefix)})
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]ObjectInfo, 0, len(out.Contents))
+	for _, obj := range out.Contents {
+		info := ObjectInfo{}
+		if obj.Key != nil {
+			info.Key = *obj.Key
+		}
+		if obj.Size != nil {
+			info.Size = *obj.Size
+		}
+		if obj.ETag != nil {
+			info.ETag = *obj.ETag
+		}
+		objects = append(objects, info)
+	}
+	return objects, nil
+}
+
+func (s *s3Backend) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
+	req, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
@@ -0,0 +1,118 @@
+// Package storage abstracts where gem blobs and cached gemspecs live so
+// gemfast isn't pinned to local disk under config.Env.GemDir. The default
+// backend preserves that behavior; s3.go, gcs.go, and azure.go let an
+// operator point gemfast at an object store instead, configured via
+// config.Cfg.Storage.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+)
+
+// ObjectInfo describes a stored object without fetching its contents.
+type ObjectInfo struct {
+	Key  string
+	Size int64
+	ETag string
+}
+
+// Backend is the minimal set of operations gemfast needs from a blob
+// store. Keys are always forward-slash-separated paths relative to the
+// backend's root, e.g. "gems/rails-7.1.0.gem" or
+// "quick/Marshal.4.8/rails-7.1.0.gemspec.rz".
+type Backend interface {
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Put(ctx context.Context, key string, r io.Reader) error
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// PresignBackend is implemented by backends that can hand back a
+// time-limited URL instead of streaming bytes through gemfast itself.
+// Only remote backends (s3, gcs, azure) implement it; localBackend does
+// not, since there's nothing to presign on disk.
+type PresignBackend interface {
+	Backend
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// presignExpiry is how long a redirect-download URL stays valid.
+const presignExpiry = 15 * time.Minute
+
+var backend Backend
+
+// Init constructs the configured backend. It must be called once during
+// startup, alongside crypto.Init and db.Connect, before any handler uses
+// Get/Put/Delete/List.
+func Init() error {
+	switch config.Cfg.Storage.Type {
+	case "", "local":
+		backend = newLocalBackend(config.Env.Dir)
+	case "s3":
+		b, err := newS3Backend(config.Cfg.Storage.S3)
+		if err != nil {
+			return fmt.Errorf("failed to initialize s3 storage backend: %w", err)
+		}
+		backend = b
+	case "gcs":
+		b, err := newGCSBackend(config.Cfg.Storage.GCS)
+		if err != nil {
+			return fmt.Errorf("failed to initialize gcs storage backend: %w", err)
+		}
+		backend = b
+	case "azure":
+		b, err := newAzureBackend(config.Cfg.Storage.Azure)
+		if err != nil {
+			return fmt.Errorf("failed to initialize azure storage backend: %w", err)
+		}
+		backend = b
+	default:
+		return fmt.Errorf("unknown storage.type %q", config.Cfg.Storage.Type)
+	}
+	return nil
+}
+
+func Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	return backend.Stat(ctx, key)
+}
+
+func Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return backend.Get(ctx, key)
+}
+
+func Put(ctx context.Context, key string, r io.Reader) error {
+	return backend.Put(ctx, key, r)
+}
+
+func Delete(ctx context.Context, key string) error {
+	return backend.Delete(ctx, key)
+}
+
+func List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	return backend.List(ctx, prefix)
+}
+
+// RedirectURL returns a presigned URL for key when the configured backend
+// supports presigning and storage.redirect_downloads is enabled. The
+// second return value is false when the handler should fall back to
+// streaming the object itself.
+func RedirectURL(ctx context.Context, key string) (string, bool, error) {
+	if !config.Cfg.Storage.RedirectDownloads {
+		return "", false, nil
+	}
+	presigner, ok := backend.(PresignBackend)
+	if !ok {
+		return "", false, nil
+	}
+	url, err := presigner.PresignGet(ctx, key, presignExpiry)
+	if err != nil {
+		return "", false, err
+	}
+	return url, true, nil
+}
@@ -0,0 +1,106 @@
+// Package upstream generalizes mirroring beyond a single hardcoded
+// config.Cfg.Mirrors[0] so an operator can configure several upstreams
+// (rubygems.org, a corporate proxy, a geo-local mirror), each with its own
+// priority and allow/deny filter, with automatic failover between them.
+// No per-upstream request timeout is applied; requests use the default
+// HTTP client.
+package upstream
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gemfast/server/internal/config"
+	"github.com/gemfast/server/internal/filter"
+
+	"github.com/rs/zerolog/log"
+)
+
+// unhealthyCooldown is how long an upstream is skipped after a connect
+// failure or 5xx before it's tried again.
+const unhealthyCooldown = 30 * time.Second
+
+var (
+	mu          sync.Mutex
+	unhealthyUntil = map[string]time.Time{}
+	lastUpstreamForGem = map[string]string{}
+)
+
+// Candidates returns the configured mirrors sorted by priority
+// (highest first), excluding any currently in their unhealthy cooldown
+// window.
+func Candidates() []config.Mirror {
+	mu.Lock()
+	defer mu.Unlock()
+	mirrors := append([]config.Mirror(nil), config.Cfg.Mirrors...)
+	var healthy []config.Mirror
+	now := time.Now()
+	for _, m := range mirrors {
+		if !m.Enabled {
+			continue
+		}
+		if until, ok := unhealthyUntil[m.Upstream]; ok && now.Before(until) {
+			continue
+		}
+		healthy = append(healthy, m)
+	}
+	sortByPriorityDesc(healthy)
+	return healthy
+}
+
+func sortByPriorityDesc(mirrors []config.Mirror) {
+	for i := 1; i < len(mirrors); i++ {
+		for j := i; j > 0 && mirrors[j].Priority > mirrors[j-1].Priority; j-- {
+			mirrors[j], mirrors[j-1] = mirrors[j-1], mirrors[j]
+		}
+	}
+}
+
+// MarkUnhealthy puts an upstream in cooldown after a connect failure or a
+// 5xx response, so subsequent requests fail over to the next-highest
+// priority upstream instead of retrying the broken one.
+func MarkUnhealthy(upstreamURL string) {
+	mu.Lock()
+	defer mu.Unlock()
+	unhealthyUntil[upstreamURL] = time.Now().Add(unhealthyCooldown)
+	log.Warn().Str("upstream", upstreamURL).Dur("cooldown", unhealthyCooldown).Msg("marking upstream unhealthy")
+}
+
+// Allowed evaluates both the global filter package and this upstream's own
+// allow/deny patterns.
+func Allowed(m config.Mirror, gemFileName string) bool {
+	if !filter.IsAllowed(gemFileName) {
+		return false
+	}
+	for _, deny := range m.Filter.Deny {
+		if ok, _ := filepath.Match(deny, gemFileName); ok {
+			return false
+		}
+	}
+	if len(m.Filter.Allow) == 0 {
+		return true
+	}
+	for _, allow := range m.Filter.Allow {
+		if ok, _ := filepath.Match(allow, gemFileName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordWinner remembers which upstream satisfied a gem's cache miss so
+// later yank/refresh operations know where it came from.
+func RecordWinner(gemName, upstreamURL string) {
+	mu.Lock()
+	defer mu.Unlock()
+	lastUpstreamForGem[gemName] = upstreamURL
+}
+
+// WinnerFor returns the upstream that last served gemName, if known.
+func WinnerFor(gemName string) (string, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	u, ok := lastUpstreamForGem[gemName]
+	return u, ok
+}